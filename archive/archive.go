@@ -0,0 +1,63 @@
+// Package archive reads step1's output, whether it was written to a directory,
+// a .tar (optionally gzipped) or a .zip, as an io/fs file system.
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Format of the output, from its name.
+type Format int
+
+const (
+	Dir Format = iota
+	Tar
+	TarGz
+	Zip
+)
+
+// FormatOf says what format a name is, by its extension.
+func FormatOf(name string) Format {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip
+	default:
+		return Dir
+	}
+}
+
+// Open opens a directory or archive. Close it when done.
+func Open(name string) (fs.FS, io.Closer, error) {
+	switch FormatOf(name) {
+	case Tar, TarGz:
+		t, err := openTar(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, t, nil
+	case Zip:
+		z, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return z, z, nil
+	default:
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			return nil, nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		}
+		return os.DirFS(name), io.NopCloser(nil), nil
+	}
+}
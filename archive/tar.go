@@ -0,0 +1,249 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// maxTarGzContent is how much a gzipped tar's files can add up to, as they are all read into memory.
+	// A var so a test can lower it.
+	maxTarGzContent int64 = 1 << 30
+)
+
+// tarFS is an index of a tar's files.
+// A plain tar's files are read from it when opened. A gzipped tar can't be seeked,
+// so its files are all read into memory, up to maxTarGzContent; for more it should be gunzipped to a plain tar.
+type tarFS struct {
+	f     *os.File
+	files map[string]*tarEntry
+	dirs  map[string][]fs.DirEntry // children of each dir, by name
+}
+
+type tarEntry struct {
+	name    string // full path
+	offset  int64  // in a plain tar
+	size    int64
+	modTime time.Time
+	content []byte // from a gzipped tar
+	dir     bool
+}
+
+func openTar(name string) (*tarFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &tarFS{
+		f:     f,
+		files: make(map[string]*tarEntry),
+		dirs:  map[string][]fs.DirEntry{".": nil},
+	}
+	err = t.index(FormatOf(name) == TarGz)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tarFS) index(gzipped bool) error {
+	var (
+		r       io.Reader = bufio.NewReaderSize(t.f, 1024*1024)
+		counter *countingReader
+	)
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		// tar.Reader reads the header and no further, so the count is where the file's content starts
+		counter = &countingReader{r: r}
+		r = counter
+	}
+	tr := tar.NewReader(r)
+	var total int64 // of a gzipped tar's files
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(h.Name, "./"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if h.Typeflag == tar.TypeDir {
+			t.addDir(name, h.ModTime)
+			continue
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		e := &tarEntry{name: name, size: h.Size, modTime: h.ModTime}
+		if gzipped {
+			total += h.Size
+			if total > maxTarGzContent {
+				return fmt.Errorf("%v: its files are more than the %v MB that can be read from a .tar.gz, gunzip it to a .tar first",
+					t.f.Name(), maxTarGzContent>>20)
+			}
+			e.content, err = io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+		} else {
+			e.offset = counter.n
+		}
+		if old, seen := t.files[name]; seen {
+			// a later file of the same name replaces it, as when extracting.
+			// In place, so its dir lists the same one
+			*old = *e
+			continue
+		}
+		t.addChild(path.Dir(name), e)
+		t.files[name] = e
+	}
+	for _, children := range t.dirs {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name() < children[j].Name()
+		})
+	}
+	return nil
+}
+
+func (t *tarFS) addDir(name string, modTime time.Time) {
+	if _, ok := t.files[name]; ok {
+		return
+	}
+	e := &tarEntry{name: name, modTime: modTime, dir: true}
+	t.files[name] = e
+	t.dirs[name] = nil
+	t.addChild(path.Dir(name), e)
+}
+
+func (t *tarFS) addChild(dir string, e *tarEntry) {
+	if dir != "." {
+		t.addDir(dir, e.modTime)
+	}
+	t.dirs[dir] = append(t.dirs[dir], tarDirEntry{e})
+}
+
+func (t *tarFS) Close() error {
+	return t.f.Close()
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &tarFile{entry: &tarEntry{name: ".", dir: true}, fsys: t}, nil
+	}
+	e, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f := &tarFile{entry: e, fsys: t}
+	if !e.dir {
+		if e.content != nil {
+			f.r = bytes.NewReader(e.content)
+		} else {
+			f.r = io.NewSectionReader(t.f, e.offset, e.size)
+		}
+	}
+	return f, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	children, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), children...), nil
+}
+
+// tarFile is an open file or dir.
+type tarFile struct {
+	entry *tarEntry
+	fsys  *tarFS
+	r     io.Reader
+	read  int // of the dir's entries, by ReadDir
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return tarFileInfo{f.entry}, nil
+}
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.entry.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: fs.ErrInvalid}
+	}
+	return f.r.Read(p)
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := f.fsys.dirs[f.entry.name][f.read:]
+	if n > 0 {
+		if len(children) == 0 {
+			return nil, io.EOF
+		}
+		children = children[:min(n, len(children))]
+	}
+	f.read += len(children)
+	return append([]fs.DirEntry(nil), children...), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type tarFileInfo struct {
+	e *tarEntry
+}
+
+func (i tarFileInfo) Name() string       { return path.Base(i.e.name) }
+func (i tarFileInfo) Size() int64        { return i.e.size }
+func (i tarFileInfo) ModTime() time.Time { return i.e.modTime }
+func (i tarFileInfo) IsDir() bool        { return i.e.dir }
+func (i tarFileInfo) Sys() any           { return nil }
+func (i tarFileInfo) Mode() fs.FileMode {
+	if i.e.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+type tarDirEntry struct {
+	e *tarEntry
+}
+
+func (d tarDirEntry) Name() string               { return path.Base(d.e.name) }
+func (d tarDirEntry) IsDir() bool                { return d.e.dir }
+func (d tarDirEntry) Type() fs.FileMode          { return tarFileInfo{d.e}.Mode().Type() }
+func (d tarDirEntry) Info() (fs.FileInfo, error) { return tarFileInfo{d.e}, nil }
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTarGzLimit checks a .tar.gz whose files are too much to hold in memory is refused.
+func TestTarGzLimit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.tar.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []string{"Issue/10/RT-1.xml", "Issue/11/RT-2.xml"} {
+		content := "<Issue/>\n"
+		if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: file, Size: int64(len(content)), Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, f} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limit := maxTarGzContent
+	t.Cleanup(func() { maxTarGzContent = limit })
+	tests := []struct {
+		limit   int64
+		wantErr bool
+	}{
+		{18, false},
+		{17, true},
+	}
+	for _, tt := range tests {
+		maxTarGzContent = tt.limit
+		fsys, closer, err := Open(name)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "gunzip it to a .tar") {
+				t.Errorf("with a limit of %v got %v, want it refused", tt.limit, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("with a limit of %v: %v", tt.limit, err)
+		}
+		if _, err = fsys.Open("Issue/11/RT-2.xml"); err != nil {
+			t.Error(err)
+		}
+		closer.Close()
+	}
+}
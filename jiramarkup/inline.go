@@ -0,0 +1,217 @@
+package jiramarkup
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	monospaceRegexp = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	linkRegexp      = regexp.MustCompile(`\[([^\[\]]+)\]`)
+	mentionRegexp   = regexp.MustCompile(`\[~([^\[\]]+)\]`)
+	imageRegexp     = regexp.MustCompile(`!([^!\s|][^!|]*?)(\|[^!]*)?!`)
+	colorRegexp     = regexp.MustCompile(`\{color(:[^}]*)?\}`)
+	inlineMacro     = regexp.MustCompile(`\{\w+(:[^}]*)?\}`)
+	urlRegexp       = regexp.MustCompile(`^(https?|ftp|mailto|file):`)
+	// imageTarget stops !Important! being read as an image
+	imageTarget      = regexp.MustCompile(`(\.\w+|^https?:.*)$`)
+	placeholderRegex = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// inline holds pieces of converted text that must not be touched by later conversions,
+// e.g. the underscores of a URL.
+type inline struct {
+	held []string
+}
+
+// hold s, returning a placeholder for it. Placeholders already in s are restored first,
+// so what is held never has any and restore needs only one pass.
+func (in *inline) hold(s string) string {
+	in.held = append(in.held, in.restore(s))
+	return fmt.Sprintf("\x00%d\x00", len(in.held)-1)
+}
+
+// restore replaces each placeholder with what it held. Anything else that looks like one is left alone.
+func (in *inline) restore(s string) string {
+	return placeholderRegex.ReplaceAllStringFunc(s, func(m string) string {
+		n, err := strconv.Atoi(strings.Trim(m, "\x00"))
+		if err != nil || n >= len(in.held) {
+			return m
+		}
+		return in.held[n]
+	})
+}
+
+func (c *converter) convertInline(s string) string {
+	var in inline
+	// NULs in the text could be mistaken for placeholders, hold them so the only ones left are ours
+	if strings.Contains(s, "\x00") {
+		s = strings.ReplaceAll(s, "\x00", in.hold("\x00"))
+	}
+
+	s = monospaceRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		return in.hold(codeSpan(monospaceRegexp.FindStringSubmatch(m)[1]))
+	})
+	s = linkRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		link, ok := c.convertLink(linkRegexp.FindStringSubmatch(m)[1])
+		if !ok {
+			return m
+		}
+		return in.hold(link)
+	})
+	s = imageRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		target := imageRegexp.FindStringSubmatch(m)[1]
+		if !imageTarget.MatchString(target) {
+			return m
+		}
+		return in.hold(fmt.Sprintf("![%v](%v)", target, linkDestination(c.attachment(target))))
+	})
+	s = colorRegexp.ReplaceAllString(s, "")
+	s = inlineMacro.ReplaceAllStringFunc(s, func(m string) string {
+		// unsupported, keep it verbatim
+		return in.hold(codeSpan(m))
+	})
+
+	// JIRA shows text literally, Markdown would treat it as HTML
+	s = strings.ReplaceAll(s, "<", "&lt;")
+
+	s = replaceDelimited(s, '*', "**", "**")
+	s = replaceDelimited(s, '-', "~~", "~~")
+	s = replaceDelimited(s, '+', "<ins>", "</ins>")
+	s = replaceDelimited(s, '^', "<sup>", "</sup>")
+	s = replaceDelimited(s, '~', "<sub>", "</sub>")
+	s = strings.ReplaceAll(s, `\\`, "<br>")
+
+	return in.restore(s)
+}
+
+// convertLink converts the inside of a [...] link.
+func (c *converter) convertLink(content string) (string, bool) {
+	switch {
+	case strings.HasPrefix(content, "~"):
+		// user mention
+		return Escape(c.user(content[1:])), true
+	case strings.HasPrefix(content, "^"):
+		// attachment
+		return fmt.Sprintf("[%v](%v)", content[1:], linkDestination(c.attachment(content[1:]))), true
+	case strings.HasPrefix(content, "#"):
+		return fmt.Sprintf("[%v](%v)", content[1:], content), true
+	}
+	text, target, ok := strings.Cut(content, "|")
+	if ok {
+		// drop any tooltip, [text|url|tooltip]
+		target, _, _ = strings.Cut(target, "|")
+		target = strings.TrimSpace(target)
+		if strings.HasPrefix(target, "^") {
+			target = c.attachment(target[1:])
+		}
+		return fmt.Sprintf("[%v](%v)", c.convertInline(text), linkDestination(target)), true
+	}
+	if urlRegexp.MatchString(content) {
+		return "<" + content + ">", true
+	}
+	// probably just text in brackets, or an issue key
+	return "", false
+}
+
+// attachment is where to find an attachment, by default alongside the document
+func (c *converter) attachment(filename string) string {
+	if c.opts.Attachment == nil || urlRegexp.MatchString(filename) {
+		return filename
+	}
+	return c.opts.Attachment(filename)
+}
+
+// user is how to show a user, by default their key.
+func (c *converter) user(key string) string {
+	if c.opts.User == nil {
+		return key
+	}
+	return c.opts.User(key)
+}
+
+// Mentions are the user keys mentioned in markup, e.g. jsmith in [~jsmith], in order.
+func Mentions(markup string) []string {
+	var keys []string
+	for _, m := range mentionRegexp.FindAllStringSubmatch(markup, -1) {
+		keys = append(keys, m[1])
+	}
+	return keys
+}
+
+// Escape backslash-escapes what Markdown would treat as markup in plain text, e.g. a user's name.
+func Escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_[]<>~|#!", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func linkDestination(target string) string {
+	if strings.ContainsAny(target, " ()<>") {
+		return "<" + strings.ReplaceAll(target, ">", "%3E") + ">"
+	}
+	return target
+}
+
+func codeSpan(s string) string {
+	ticks := "`"
+	for strings.Contains(s, ticks) {
+		ticks += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return ticks + " " + s + " " + ticks
+	}
+	return ticks + s + ticks
+}
+
+// replaceDelimited converts JIRA's *strong* style of markup.
+// Like JIRA, the opening delimiter must start a word and the closing one end a word.
+func replaceDelimited(s string, delim byte, open string, close string) string {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		if s[i] == delim && opens(s, i, delim) {
+			if j := closingDelimiter(s, i+1, delim); j > 0 {
+				b.WriteString(open)
+				b.WriteString(s[i+1 : j])
+				b.WriteString(close)
+				i = j + 1
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+func opens(s string, i int, delim byte) bool {
+	if i > 0 && (isWordByte(s[i-1]) || s[i-1] == delim) {
+		return false
+	}
+	return i+1 < len(s) && s[i+1] != delim && !unicode.IsSpace(rune(s[i+1]))
+}
+
+func closingDelimiter(s string, from int, delim byte) int {
+	for j := from + 1; j < len(s); j++ {
+		if s[j] != delim || unicode.IsSpace(rune(s[j-1])) {
+			continue
+		}
+		if j+1 == len(s) || (!isWordByte(s[j+1]) && s[j+1] != delim) {
+			return j
+		}
+	}
+	return -1
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
@@ -0,0 +1,292 @@
+// Package jiramarkup converts JIRA's wiki markup into GitHub-flavoured Markdown.
+//
+// It is line based and forgiving: anything it does not understand is kept,
+// and macros it does not support are preserved verbatim in a fenced block
+// rather than being mangled.
+package jiramarkup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Options adjust how markup is converted.
+type Options struct {
+	// HeadingOffset demotes headings, e.g. 2 turns h1. into ###
+	// so the converted text can sit under a section of a larger document.
+	HeadingOffset int
+	// Attachment, if set, gives the link destination for an attachment's filename,
+	// as used in [^file.txt] and !image.png!
+	Attachment func(filename string) string
+	// User, if set, gives the name to show for a user key, as used in [~key].
+	// Otherwise the key is shown. Either way there's no @, which GitHub would take as a mention of its own user.
+	User func(key string) string
+}
+
+// ToMarkdown converts JIRA wiki markup to GitHub-flavoured Markdown.
+func ToMarkdown(markup string, opts Options) string {
+	markup = strings.ReplaceAll(markup, "\r\n", "\n")
+	markup = strings.ReplaceAll(markup, "\r", "\n")
+	c := converter{opts: opts}
+	c.convertLines(strings.Split(markup, "\n"))
+	return strings.Trim(strings.Join(c.out, "\n"), "\n")
+}
+
+var (
+	headingRegexp = regexp.MustCompile(`^h([1-6])\.\s*(.*)$`)
+	listRegexp    = regexp.MustCompile(`^([*#]+|-)\s+(.*)$`)
+	quoteRegexp   = regexp.MustCompile(`^bq\.\s+(.*)$`)
+	ruleRegexp    = regexp.MustCompile(`^-{4,}$`)
+	// macroRegexp matches a line starting with a macro such as {code:java} or {panel:title=Hi}
+	macroRegexp = regexp.MustCompile(`^\{(\w+)(?::([^}]*))?\}(.*)$`)
+)
+
+// alerts maps JIRA's admonition macros to GitHub's alert types.
+var alerts = map[string]string{
+	"info":    "NOTE",
+	"tip":     "TIP",
+	"note":    "IMPORTANT",
+	"warning": "WARNING",
+}
+
+type blockKind int
+
+const (
+	blankBlock blockKind = iota
+	paragraphBlock
+	listBlock
+	separateBlock // always set apart from its neighbours by a blank line
+)
+
+type converter struct {
+	opts Options
+	out  []string
+	last blockKind
+}
+
+// start prepares for a line of the given kind.
+// Markdown lets some blocks swallow the line after them (e.g. a paragraph line after a table
+// becomes a table row), so whenever the kind changes put a blank line between them.
+func (c *converter) start(kind blockKind) {
+	if c.last != blankBlock && (kind != c.last || kind == separateBlock) {
+		c.out = append(c.out, "")
+	}
+	c.last = kind
+}
+
+func (c *converter) emit(kind blockKind, lines ...string) {
+	c.start(kind)
+	c.out = append(c.out, lines...)
+}
+
+func (c *converter) blank() {
+	if c.last != blankBlock {
+		c.out = append(c.out, "")
+	}
+	c.last = blankBlock
+}
+
+func (c *converter) convertLines(lines []string) {
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		if trimmed == "" {
+			c.blank()
+			continue
+		}
+
+		if m := macroRegexp.FindStringSubmatch(trimmed); m != nil {
+			if next, ok := c.convertMacro(lines, i, m[1], m[2], m[3]); ok {
+				i = next
+				continue
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "|") {
+			end := i
+			for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "|") {
+				end++
+			}
+			c.emit(separateBlock, c.convertTable(lines[i:end])...)
+			i = end - 1
+			continue
+		}
+
+		if m := headingRegexp.FindStringSubmatch(trimmed); m != nil {
+			level := int(m[1][0]-'0') + c.opts.HeadingOffset
+			level = min(max(level, 1), 6)
+			c.emit(separateBlock, strings.Repeat("#", level)+" "+c.convertInline(m[2]))
+			continue
+		}
+
+		if m := quoteRegexp.FindStringSubmatch(trimmed); m != nil {
+			c.emit(separateBlock, "> "+c.convertInline(m[1]))
+			continue
+		}
+
+		if ruleRegexp.MatchString(trimmed) {
+			c.emit(separateBlock, "---")
+			continue
+		}
+
+		if m := listRegexp.FindStringSubmatch(trimmed); m != nil {
+			c.emit(listBlock, listItem(m[1], c.convertInline(m[2])))
+			continue
+		}
+
+		c.emit(paragraphBlock, c.convertInline(trimmed))
+	}
+}
+
+// convertMacro handles a block macro found at the start of lines[i].
+// It returns the index of the last line it consumed, or false if the macro should be treated as inline text.
+func (c *converter) convertMacro(lines []string, i int, name string, params string, rest string) (int, bool) {
+	if name == "color" {
+		// purely presentational, dealt with inline
+		return i, false
+	}
+
+	body, trailing, end, closed := collectMacroBody(lines, i, name, rest)
+	if !closed {
+		_, known := alerts[name]
+		if known || name == "quote" || name == "panel" {
+			return i, false
+		}
+		// Unsupported and standalone, e.g. {toc}. Keep the original text so nothing is lost.
+		c.emit(separateBlock, fence("", []string{strings.TrimSpace(lines[i])})...)
+		return i, true
+	}
+	original := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.Join(lines[i:end+1], "\n")), trailing))
+	next := end
+	if trailing != "" {
+		// there's more after the closing tag, go around again for it
+		lines[end] = trailing
+		next = end - 1
+	}
+
+	switch name {
+	case "code", "noformat":
+		lang := ""
+		if name == "code" && params != "" && !strings.Contains(params, "=") {
+			lang = strings.ToLower(params)
+		}
+		c.emit(separateBlock, fence(lang, trimBlankLines(body))...)
+		return next, true
+	case "quote":
+		c.emit(separateBlock, c.nested(body)...)
+		return next, true
+	case "panel":
+		c.emit(separateBlock, c.nested(body, c.panelTitle(params)...)...)
+		return next, true
+	}
+	if alert, ok := alerts[name]; ok {
+		c.emit(separateBlock, c.nested(body, "> [!"+alert+"]")...)
+		return next, true
+	}
+
+	// Unsupported. Keep the original text so nothing is lost.
+	c.emit(separateBlock, fence("", strings.Split(original, "\n"))...)
+	return next, true
+}
+
+// nested converts the body of a quote-like macro and prefixes it for a Markdown blockquote.
+// header lines are already prefixed.
+func (c *converter) nested(body []string, header ...string) []string {
+	inner := converter{opts: c.opts}
+	inner.convertLines(body)
+	result := header
+	for _, line := range trimBlankLines(inner.out) {
+		if line == "" {
+			result = append(result, ">")
+		} else {
+			result = append(result, "> "+line)
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, ">")
+	}
+	return result
+}
+
+// collectMacroBody finds the lines between an opening macro tag on lines[i] and its closing tag.
+// rest is the text following the opening tag on lines[i].
+// Returns the body, any text after the closing tag, the index of the line the closing tag is on,
+// and whether a closing tag was found at all.
+func collectMacroBody(lines []string, i int, name string, rest string) ([]string, string, int, bool) {
+	closeTag := "{" + name + "}"
+	var body []string
+	for j, line := i, rest; j < len(lines); j++ {
+		if j > i {
+			line = lines[j]
+		}
+		if k := strings.Index(line, closeTag); k >= 0 {
+			if before := line[:k]; strings.TrimSpace(before) != "" || j > i {
+				body = append(body, before)
+			}
+			return body, strings.TrimSpace(line[k+len(closeTag):]), j, true
+		}
+		body = append(body, line)
+	}
+	// Never closed. Code blocks run to the end like JIRA displays them, anything else is left alone.
+	if name == "code" || name == "noformat" {
+		return body, "", len(lines) - 1, true
+	}
+	return nil, "", i, false
+}
+
+func (c *converter) panelTitle(params string) []string {
+	for _, param := range strings.Split(params, "|") {
+		k, v, ok := strings.Cut(param, "=")
+		if ok && strings.TrimSpace(k) == "title" {
+			return []string{"> **" + c.convertInline(strings.TrimSpace(v)) + "**", ">"}
+		}
+	}
+	return nil
+}
+
+func fence(lang string, body []string) []string {
+	// the fence must be longer than any run of backticks in the body
+	longest := 0
+	for _, line := range body {
+		run := 0
+		for _, r := range line {
+			if r == '`' {
+				run++
+				longest = max(longest, run)
+			} else {
+				run = 0
+			}
+		}
+	}
+	marker := strings.Repeat("`", max(3, longest+1))
+	result := []string{marker + lang}
+	result = append(result, body...)
+	return append(result, marker)
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// listItem converts a JIRA list marker such as "#*" (a bullet inside a numbered list).
+func listItem(marker string, text string) string {
+	indent := ""
+	for _, r := range marker[:len(marker)-1] {
+		if r == '#' {
+			indent += "   " // wide enough for "1. "
+		} else {
+			indent += "  "
+		}
+	}
+	if marker[len(marker)-1] == '#' {
+		return fmt.Sprintf("%v1. %v", indent, text)
+	}
+	return fmt.Sprintf("%v- %v", indent, text)
+}
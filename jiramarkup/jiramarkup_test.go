@@ -0,0 +1,82 @@
+package jiramarkup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		markup string
+		want   string
+	}{
+		{"headings", "h1. Title\nh3. Sub", "# Title\n\n### Sub"},
+		{"code", "{code:java}\nint x = 1;\n{code}", "```java\nint x = 1;\n```"},
+		{"noformat is left alone", "{noformat}\n*not bold*\n{noformat}", "```\n*not bold*\n```"},
+		{"bold", "a *bold* word", "a **bold** word"},
+		{"italic", "an _italic_ word", "an _italic_ word"},
+		{"strikethrough, underline and monospace", "-struck- +under+ {{mono_x}}", "~~struck~~ <ins>under</ins> `mono_x`"},
+		{"table", "||a||b||\n|1|2|", "| a | b |\n|---|---|\n| 1 | 2 |"},
+		{"link", "see [the docs|https://example.com/a_b]", "see [the docs](https://example.com/a_b)"},
+		{"bare link", "[https://example.com]", "<https://example.com>"},
+		{"mention", "thanks [~JIRAUSER12345]", "thanks JIRAUSER12345"},
+		{"quote", "{quote}\nquoted *text*\n{quote}", "> quoted **text**"},
+		{"panel", "{panel:title=Note}\ninside\n{panel}", "> **Note**\n>\n> inside"},
+		{"color is dropped", "{color:red}red text{color}", "red text"},
+		{"numbered list", "# one\n# two\n## nested", "1. one\n1. two\n   1. nested"},
+		{"bullet list", "* a\n** b", "- a\n  - b"},
+		{"bullet in a numbered list", "# one\n#* bullet", "1. one\n   - bullet"},
+		{"unsupported macro", "{toc}", "```\n{toc}\n```"},
+		{"unsupported macro with a body", "{expand:title=More}\nhidden\n{expand}", "```\n{expand:title=More}\nhidden\n{expand}\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToMarkdown(tt.markup, Options{}); got != tt.want {
+				t.Errorf("ToMarkdown(%q)\n got %q\nwant %q", tt.markup, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMarkdownHeadingOffset(t *testing.T) {
+	got := ToMarkdown("h1. Title", Options{HeadingOffset: 2})
+	if want := "### Title"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestToMarkdownUser(t *testing.T) {
+	names := map[string]string{"jsmith": "Jo *Smith*"}
+	user := func(key string) string {
+		if name, ok := names[key]; ok {
+			return name
+		}
+		return key
+	}
+	got := ToMarkdown("cc [~jsmith] and [~gone]", Options{User: user})
+	if want := `cc Jo \*Smith\* and gone`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := Mentions("cc [~jsmith] and [~gone], [not] [~]"), []string{"jsmith", "gone"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Mentions got %q, want %q", got, want)
+	}
+}
+
+// TestToMarkdownPlaceholders checks text that looks like the placeholders used while converting is kept as it is.
+func TestToMarkdownPlaceholders(t *testing.T) {
+	tests := []struct {
+		markup string
+		want   string
+	}{
+		{"\x000\x00----_", "\x000\x00----_"},
+		{"a \x001\x00 {{b}}", "a \x001\x00 `b`"},
+		{"]{{{panel}{color}{panel}\x000\x00||}}bq. h1. ", "]`{panel}{color}{panel}\x000\x00||`bq. h1."},
+		{"[{{code}}|https://example.com]", "[`code`](https://example.com)"},
+	}
+	for _, tt := range tests {
+		if got := ToMarkdown(tt.markup, Options{}); got != tt.want {
+			t.Errorf("ToMarkdown(%q)\n got %q\nwant %q", tt.markup, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package jiramarkup
+
+import (
+	"strings"
+)
+
+// convertTable converts consecutive JIRA table rows, ||heading||heading|| and |cell|cell|
+func (c *converter) convertTable(lines []string) []string {
+	var (
+		rows    [][]string
+		columns int
+	)
+	for _, line := range lines {
+		row := c.splitRow(strings.TrimSpace(line))
+		rows = append(rows, row)
+		columns = max(columns, len(row))
+	}
+
+	// Markdown insists on a heading row
+	var result []string
+	if !strings.HasPrefix(strings.TrimSpace(lines[0]), "||") {
+		result = append(result, formatRow(make([]string, columns)))
+	} else {
+		result = append(result, formatRow(pad(rows[0], columns)))
+		rows = rows[1:]
+	}
+	result = append(result, "|"+strings.Repeat("---|", columns))
+	for _, row := range rows {
+		result = append(result, formatRow(pad(row, columns)))
+	}
+	return result
+}
+
+// splitRow splits on the cell separators | and ||, but not those inside [links] or {{monospace}}.
+func (c *converter) splitRow(line string) []string {
+	var (
+		cells   []string
+		current strings.Builder
+		depth   int
+	)
+	for i := 0; i < len(line); i++ {
+		b := line[i]
+		switch {
+		case b == '[' || b == '{':
+			depth++
+		case (b == ']' || b == '}') && depth > 0:
+			depth--
+		case b == '|' && depth == 0:
+			if i > 0 {
+				cells = append(cells, current.String())
+				current.Reset()
+			}
+			if i+1 < len(line) && line[i+1] == '|' {
+				i++
+			}
+			continue
+		}
+		current.WriteByte(b)
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		cells = append(cells, current.String())
+	}
+	for i, cell := range cells {
+		cells[i] = strings.ReplaceAll(c.convertInline(strings.TrimSpace(cell)), "|", `\|`)
+	}
+	return cells
+}
+
+func pad(row []string, columns int) []string {
+	for len(row) < columns {
+		row = append(row, "")
+	}
+	return row
+}
+
+func formatRow(cells []string) string {
+	return "| " + strings.Join(cells, " | ") + " |"
+}
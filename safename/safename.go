@@ -0,0 +1,55 @@
+// Package safename makes values safe to use as file and dir names,
+// so step1 writes and step2 looks for the same paths.
+package safename
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLength of an encoded name in bytes, leaving room for an extension
+	// under the usual filesystem limit of 255.
+	MaxLength = 200
+	// hashLength is how many hex digits of the value's hash end a shortened name.
+	hashLength = 12
+)
+
+var (
+	// safeRegexp matches values we accept as paths/names in the filesystem as they are.
+	safeRegexp *regexp.Regexp = regexp.MustCompile(`^[\w \[\]()\-&!]+$`)
+)
+
+// Encode makes a value safe to use as a file or dir name, e.g. a project key with a slash or a unicode
+// issue type name. Safe values are unchanged, in others each unsafe byte is percent-encoded,
+// e.g. "a/b" is "a%2Fb", which url.PathUnescape reverses.
+//
+// A name longer than MaxLength, e.g. a long custom field name in Japanese, is cut short
+// and ends with "~" and a hash of the whole value instead, so it is still unique but can't be reversed.
+func Encode(value string) string {
+	encoded := value
+	if !safeRegexp.MatchString(value) {
+		var b strings.Builder
+		for i := 0; i < len(value); i++ {
+			c := value[i]
+			if c < utf8.RuneSelf && safeRegexp.Match([]byte{c}) {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		encoded = b.String()
+	}
+	if len(encoded) <= MaxLength {
+		return encoded
+	}
+	cut := MaxLength - 1 - hashLength
+	// don't split a %XX
+	if i := strings.LastIndexByte(encoded[:cut], '%'); i >= 0 && i > cut-3 {
+		cut = i
+	}
+	return fmt.Sprintf("%v~%x", encoded[:cut], sha256.Sum256([]byte(value)))[:cut+1+hashLength]
+}
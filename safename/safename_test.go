@@ -0,0 +1,50 @@
+package safename
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"safe", "MY-PROJ 1", "MY-PROJ 1"},
+		{"slash", "a/b", "a%2Fb"},
+		{"unicode", "é", "%C3%A9"},
+		{"dots", "..", "%2E%2E"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Encode(tt.value)
+			if got != tt.want {
+				t.Errorf("Encode(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if back, err := url.PathUnescape(got); err != nil || back != tt.value {
+				t.Errorf("url.PathUnescape(%q) = %q, %v, want %q", got, back, err, tt.value)
+			}
+		})
+	}
+}
+
+func TestEncodeLong(t *testing.T) {
+	long := strings.Repeat("顧客の要望", 10)
+	for _, value := range []string{long, strings.Repeat("a", 300), "b" + long} {
+		got := Encode(value)
+		if len(got) > MaxLength {
+			t.Errorf("Encode(%q) is %v bytes, want at most %v", value, len(got), MaxLength)
+		}
+		if got[len(got)-hashLength-1] != '~' {
+			t.Errorf("Encode(%q) = %q, want it to end with a hash", value, got)
+		}
+		if _, err := url.PathUnescape(got); err != nil {
+			t.Errorf("Encode(%q) = %q, which has a split %%XX: %v", value, got, err)
+		}
+	}
+	if Encode(long) == Encode(long+"x") {
+		t.Errorf("two long values that start the same have the same name %q", Encode(long))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+
+	"github.com/ishepherd/jira-to-markdown/safename"
+)
+
+const (
+	xsiNamespace string = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+var (
+	// aoIssueColumns are the columns that, if a table has one, hold the id of the issue a row belongs to.
+	aoIssueColumns []string = []string{"ISSUE_ID", "ISSUEID", "ISSUE"}
+)
+
+// aoValue is one column's value in a <row>, e.g. <string>Sprint 1</string> or <integer xsi:nil="true"/>
+type aoValue struct {
+	XMLName xml.Name
+	Nil     bool   `xml:"http://www.w3.org/2001/XMLSchema-instance nil,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type aoRow struct {
+	Values []aoValue `xml:",any"`
+}
+
+// turnActiveObjectsIntoFiles splits activeobjects.xml, where JIRA Software, Service Desk and add-ons keep their data.
+// It's a database dump:
+//
+//	<backup>
+//	  <table name="AO_60DB71_SPRINT">...schema...</table>
+//	  <data tableName="AO_60DB71_SPRINT">
+//	    <column name="ID"/> <column name="NAME"/> ...
+//	    <row> <integer>1</integer> <string>Sprint 1</string> ... </row>
+//
+// A row on its own doesn't say which column is which, so rather than copying them byte for byte,
+// each row is written as <AO_60DB71_SPRINT><ID>1</ID><NAME>Sprint 1</NAME>...</AO_60DB71_SPRINT>
+// to <table>/<ID>.xml, or Issue/<issue id>/<table>/<ID>.xml if the table has an issue id column.
+// Under an issueFilter, the rows of issues that aren't kept are skipped.
+// Illegal characters are replaced like in entities.xml, and noted at the end of the manifest.
+func turnActiveObjectsIntoFiles(fileName string, out *splitOutput, opts options) error {
+	f, err := openActiveObjects(fileName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("no %v, skipping it", activeObjectsFile)
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	s := newSanitizer(f, opts.escape)
+	// counted in the log at the end, the manifest has each one
+	s.quiet = true
+	d := xml.NewDecoder(bufio.NewReaderSize(s, 1024*1024))
+	d.Strict = false
+
+	var (
+		table   string
+		columns []string
+		ids     = newFallbackIds()
+	)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				if len(s.replaced) > 0 {
+					log.Printf("replaced %v illegal characters in %v", len(s.replaced), activeObjectsFile)
+				}
+				return out.activeObjectsReplaced(s)
+			}
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "data":
+			table, err = makeAttributes(start).value("tableName")
+			columns = nil
+		case "column":
+			var column string
+			column, err = makeAttributes(start).value("name")
+			columns = append(columns, column)
+		case "row":
+			var row aoRow
+			err = d.DecodeElement(&row, &start)
+			if err != nil {
+				return err
+			}
+			err = writeActiveObjectsRow(out.sink, ids, opts.issues, table, columns, row)
+		case "table", "database":
+			// the schema, not interested
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeActiveObjectsRow(out sink, ids *fallbackIds, issues *issueFilter, table string, columns []string, row aoRow) error {
+	if len(row.Values) != len(columns) {
+		return fmt.Errorf("%v: a row has %v values for %v columns", table, len(row.Values), len(columns))
+	}
+	values := make(map[string]string)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%v>\n", table)
+	for i, v := range row.Values {
+		if v.Nil {
+			continue
+		}
+		values[columns[i]] = v.Text
+		fmt.Fprintf(&b, "  <%v>", columns[i])
+		err := xml.EscapeText(&b, []byte(v.Text))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "</%v>\n", columns[i])
+	}
+	fmt.Fprintf(&b, "</%v>\n", table)
+
+	id, ok := values["ID"]
+	if !ok || id == "" {
+		// made from the table and the row's values
+		id = ids.make(table, b.String())
+	}
+	dir := safename.Encode(table)
+	id = safename.Encode(id)
+	name := fmt.Sprintf("%v/%v.xml", dir, id)
+	for _, column := range aoIssueColumns {
+		issue, ok := values[column]
+		if ok && issue != "" {
+			if issues != nil && issues.skipsIssue(table, issue) {
+				return nil
+			}
+			name = fmt.Sprintf("Issue/%v/%v/%v.xml", safename.Encode(issue), dir, id)
+			break
+		}
+	}
+	return out.write(name, b.Bytes())
+}
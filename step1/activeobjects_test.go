@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memorySink keeps what's written, by name.
+type memorySink map[string]string
+
+func (m memorySink) write(name string, content []byte) error {
+	m[name] = string(content)
+	return nil
+}
+
+func (m memorySink) flush() error { return nil }
+func (m memorySink) close() error { return nil }
+
+func TestWriteActiveObjectsRow(t *testing.T) {
+	sprintColumns := []string{"ID", "NAME", "CLOSED", "END_DATE"}
+	tests := []struct {
+		name    string
+		table   string
+		columns []string
+		row     string
+		issues  *issueFilter
+		want    string // name of the file, "" for none
+		content string
+		wantErr string
+	}{
+		{
+			name:    "columns become elements",
+			table:   "AO_60DB71_SPRINT",
+			columns: sprintColumns,
+			row:     `<row><integer>1</integer><string>Sprint &lt;1&gt; &amp; more</string><boolean>true</boolean><timestamp>2020-01-02T10:00:00.000Z</timestamp></row>`,
+			want:    "AO_60DB71_SPRINT/1.xml",
+			content: "<AO_60DB71_SPRINT>\n  <ID>1</ID>\n  <NAME>Sprint &lt;1&gt; &amp; more</NAME>\n  <CLOSED>true</CLOSED>\n  <END_DATE>2020-01-02T10:00:00.000Z</END_DATE>\n</AO_60DB71_SPRINT>\n",
+		},
+		{
+			name:    "nil values are left out",
+			table:   "AO_60DB71_SPRINT",
+			columns: sprintColumns,
+			row:     `<row xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><integer>2</integer><string>Sprint 2</string><boolean>false</boolean><timestamp xsi:nil="true"/></row>`,
+			want:    "AO_60DB71_SPRINT/2.xml",
+			content: "<AO_60DB71_SPRINT>\n  <ID>2</ID>\n  <NAME>Sprint 2</NAME>\n  <CLOSED>false</CLOSED>\n</AO_60DB71_SPRINT>\n",
+		},
+		{
+			name:    "under the issue",
+			table:   "AO_60DB71_ISSUERANKING",
+			columns: []string{"ID", "ISSUE_ID", "NEXT_ID"},
+			row:     `<row><integer>3</integer><integer>10</integer><integer>11</integer></row>`,
+			want:    "Issue/10/AO_60DB71_ISSUERANKING/3.xml",
+			content: "<AO_60DB71_ISSUERANKING>\n  <ID>3</ID>\n  <ISSUE_ID>10</ISSUE_ID>\n  <NEXT_ID>11</NEXT_ID>\n</AO_60DB71_ISSUERANKING>\n",
+		},
+		{
+			name:    "an issue that isn't kept",
+			table:   "AO_60DB71_ISSUERANKING",
+			columns: []string{"ID", "ISSUE_ID", "NEXT_ID"},
+			row:     `<row><integer>4</integer><integer>20</integer><integer>11</integer></row>`,
+			issues:  &issueFilter{issues: map[string]bool{"10": true}, skipped: make(map[string]int)},
+		},
+		{
+			name:    "no ID column",
+			table:   "AO_ABC_PROPERTY",
+			columns: []string{"KEY", "VALUE"},
+			row:     `<row><string>colour</string><string>red</string></row>`,
+			want:    "AO_ABC_PROPERTY/_ID.xml",
+			content: "<AO_ABC_PROPERTY>\n  <KEY>colour</KEY>\n  <VALUE>red</VALUE>\n</AO_ABC_PROPERTY>\n",
+		},
+		{
+			name:    "values that aren't safe as a file name",
+			table:   "AO_ABC_LINK",
+			columns: []string{"ID", "ISSUE"},
+			row:     `<row><string>a/b</string><string>RT-1</string></row>`,
+			want:    "Issue/RT-1/AO_ABC_LINK/a%2Fb.xml",
+			content: "<AO_ABC_LINK>\n  <ID>a/b</ID>\n  <ISSUE>RT-1</ISSUE>\n</AO_ABC_LINK>\n",
+		},
+		{
+			name:    "too few values",
+			table:   "AO_60DB71_SPRINT",
+			columns: sprintColumns,
+			row:     `<row><integer>5</integer></row>`,
+			wantErr: "AO_60DB71_SPRINT: a row has 1 values for 4 columns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var row aoRow
+			if err := xml.Unmarshal([]byte(tt.row), &row); err != nil {
+				t.Fatal(err)
+			}
+			out := make(memorySink)
+			ids := newFallbackIds()
+			err := writeActiveObjectsRow(out, ids, tt.issues, tt.table, tt.columns, row)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(out) != 0 {
+					t.Errorf("got %v, want nothing written", out)
+				}
+				return
+			}
+			want := strings.ReplaceAll(tt.want, "_ID", newFallbackIds().make(tt.table, tt.content))
+			if got, ok := out[want]; !ok || got != tt.content || len(out) != 1 {
+				t.Errorf("got %q, want %v with\n%v", out, want, tt.content)
+			}
+		})
+	}
+}
+
+const testActiveObjects = `<?xml version="1.0" encoding="UTF-8"?>
+<backup xmlns="http://www.atlassian.com/ao" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <database><meta key="database.name" value="PostgreSQL"/></database>
+  <table name="AO_60DB71_SPRINT"><column name="ID" primaryKey="true"/></table>
+  <data tableName="AO_60DB71_SPRINT">
+    <column name="ID"/>
+    <column name="NAME"/>
+    <row>
+      <integer>1</integer>
+      <string>Sprint` + "\x1d" + `1</string>
+    </row>
+  </data>
+  <data tableName="AO_60DB71_ISSUERANKING">
+    <column name="ID"/>
+    <column name="ISSUE_ID"/>
+    <row>
+      <integer>2</integer>
+      <integer>10</integer>
+    </row>
+  </data>
+</backup>
+`
+
+// TestActiveObjectsSplit checks activeobjects.xml next to entities.xml is split too, with its illegal characters noted.
+func TestActiveObjectsSplit(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	input := writeInput(t, roundTripEntities)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(input), activeObjectsFile), []byte(testActiveObjects), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(input, "out", testOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"AO_60DB71_SPRINT/1.xml":                "<AO_60DB71_SPRINT>\n  <ID>1</ID>\n  <NAME>Sprint{GS}1</NAME>\n</AO_60DB71_SPRINT>\n",
+		"Issue/10/AO_60DB71_ISSUERANKING/2.xml": "<AO_60DB71_ISSUERANKING>\n  <ID>2</ID>\n  <ISSUE_ID>10</ISSUE_ID>\n</AO_60DB71_ISSUERANKING>\n",
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join("out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%v got\n%s\nwant\n%v", name, got, want)
+		}
+	}
+	manifest, err := os.ReadFile(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), "#\t"+activeObjectsFile+"\t") {
+		t.Errorf("want the replaced GS in the manifest, got\n%s", manifest)
+	}
+	if err = verify(input, "out"); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+)
+
+// elementFilter decides which elements are boring, i.e. go to the remainder instead of their own file.
+// --exclude beats --include, which beats the boring list.
+type elementFilter struct {
+	boring  []string // glob patterns
+	include []string
+	exclude []string
+
+	cache map[string]bool // by element name
+}
+
+// newElementFilter uses the boring list in the JSON file, or boringElements if boringFile is empty.
+func newElementFilter(boringFile string, include []string, exclude []string) (*elementFilter, error) {
+	f := elementFilter{
+		include: include,
+		exclude: exclude,
+		cache:   make(map[string]bool),
+	}
+	if boringFile == "" {
+		for name := range boringElements {
+			f.boring = append(f.boring, name)
+		}
+		sort.Strings(f.boring)
+	} else {
+		b, err := os.ReadFile(boringFile)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(b, &f.boring)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", boringFile, err)
+		}
+	}
+	for _, patterns := range [][]string{f.boring, f.include, f.exclude} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("%q: %w", p, err)
+			}
+		}
+	}
+	return &f, nil
+}
+
+func (f *elementFilter) isBoring(name string) bool {
+	boring, ok := f.cache[name]
+	if !ok {
+		switch {
+		case matchesAny(f.exclude, name):
+			boring = true
+		case matchesAny(f.include, name):
+			boring = false
+		default:
+			boring = matchesAny(f.boring, name)
+		}
+		f.cache[name] = boring
+	}
+	return boring
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// logDiverted summarises which element types went to the remainder.
+func logDiverted(diverted map[string]int) {
+	if len(diverted) == 0 {
+		return
+	}
+	names := make([]string, 0, len(diverted))
+	for name := range diverted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Printf("%v element types were written to the remainder:", len(names))
+	for _, name := range names {
+		log.Printf("  %v: %v", name, diverted[name])
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	// changeGroupSpillFile holds the changeGroupIndex entries that don't fit in memory
+	changeGroupSpillFile string = "_tmp/changegroups.idx"
+	// maxChangeGroupsInMemory before they are spilled to disk. Each takes ~100 bytes in memory.
+	maxChangeGroupsInMemory int = 5_000_000
+)
+
+// changeGroupIndex is the issue of each ChangeGroup, so its ChangeItems can be written straight under the issue.
+// JIRA writes all the ChangeGroups before the ChangeItems, so by the time the items are read
+// there can be millions of groups to remember.
+//
+// Entries are kept in memory until there are too many, then spilled to a file
+// which has the issue id at 8 × the ChangeGroup id. The file is sparse, mostly, so its size doesn't matter.
+// Entries whose ChangeGroup or issue id isn't a number can't be spilled, so they are kept in memory
+// the whole run, and in the checkpoint.
+// Checkpoints spill everything else, so the index survives a --resume.
+type changeGroupIndex struct {
+	memory   map[string]string // entries that can be spilled
+	unsaved  []string          // ids in memory that aren't in the spill file yet
+	others   map[string]string // entries that can't be spilled
+	spill    *os.File
+	resuming bool // keep the spill file from last time
+	missed   int  // lookups of ChangeGroups we hadn't seen
+}
+
+func newChangeGroupIndex(resuming bool) *changeGroupIndex {
+	return &changeGroupIndex{memory: make(map[string]string), others: make(map[string]string), resuming: resuming}
+}
+
+func (x *changeGroupIndex) add(group string, issue string) error {
+	if _, _, ok := spillEntry(group, issue); !ok {
+		x.others[group] = issue
+		return nil
+	}
+	x.memory[group] = issue
+	x.unsaved = append(x.unsaved, group)
+	if len(x.memory) < maxChangeGroupsInMemory {
+		return nil
+	}
+	err := x.save()
+	if err != nil {
+		return err
+	}
+	// they are all in the spill file now
+	clear(x.memory)
+	return nil
+}
+
+// issue of a ChangeGroup, or "" if we haven't seen the ChangeGroup, which is counted in missed.
+func (x *changeGroupIndex) issue(group string) (string, error) {
+	issue, err := x.find(group)
+	if err == nil && issue == "" {
+		x.missed++
+	}
+	return issue, err
+}
+
+// find the issue of a ChangeGroup, or "" if we haven't seen the ChangeGroup.
+func (x *changeGroupIndex) find(group string) (string, error) {
+	if issue, ok := x.memory[group]; ok {
+		return issue, nil
+	}
+	if issue, ok := x.others[group]; ok {
+		return issue, nil
+	}
+	offset, ok := spillOffset(group)
+	if !ok || x.spill == nil && !x.resuming {
+		return "", nil
+	}
+	err := x.open()
+	if err != nil {
+		return "", err
+	}
+	var b [8]byte
+	_, err = x.spill.ReadAt(b[:], offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	n := binary.LittleEndian.Uint64(b[:])
+	if n == 0 {
+		return "", nil
+	}
+	return strconv.FormatUint(n-1, 10), nil
+}
+
+// save writes the entries added since last time to the spill file.
+func (x *changeGroupIndex) save() error {
+	if len(x.unsaved) == 0 {
+		return nil
+	}
+	err := x.open()
+	if err != nil {
+		return err
+	}
+	for i, group := range x.unsaved {
+		// add only puts entries that can be spilled in memory
+		offset, issue, _ := spillEntry(group, x.memory[group])
+		var b [8]byte
+		// 0 is no entry
+		binary.LittleEndian.PutUint64(b[:], issue+1)
+		_, err = x.spill.WriteAt(b[:], offset)
+		if err != nil {
+			// keep the rest to try again
+			x.unsaved = x.unsaved[i:]
+			return err
+		}
+	}
+	x.unsaved = x.unsaved[:0]
+	return nil
+}
+
+func (x *changeGroupIndex) open() error {
+	if x.spill != nil {
+		return nil
+	}
+	flags := os.O_RDWR | os.O_CREATE
+	if !x.resuming {
+		flags |= os.O_TRUNC
+	}
+	err := ensureDirExists(changeGroupSpillFile)
+	if err != nil {
+		return err
+	}
+	x.spill, err = os.OpenFile(changeGroupSpillFile, flags, 0644)
+	return err
+}
+
+// close the spill file and delete it, it's no use once step1 is finished.
+func (x *changeGroupIndex) close() error {
+	if x.spill == nil {
+		return nil
+	}
+	err := x.spill.Close()
+	x.spill = nil
+	if rerr := os.Remove(changeGroupSpillFile); err == nil && !errors.Is(rerr, os.ErrNotExist) {
+		err = rerr
+	}
+	return err
+}
+
+// spillOffset is where a ChangeGroup's entry goes in the spill file, if its id is a number.
+func spillOffset(group string) (int64, bool) {
+	id, err := strconv.ParseUint(group, 10, 59)
+	if err != nil {
+		return 0, false
+	}
+	return int64(id) * 8, true
+}
+
+// spillEntry is where a ChangeGroup's entry goes in the spill file and the issue id to write there,
+// if both ids are numbers.
+func spillEntry(group string, issue string) (int64, uint64, bool) {
+	offset, ok := spillOffset(group)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseUint(issue, 10, 63)
+	if err != nil {
+		return 0, 0, false
+	}
+	return offset, id, true
+}
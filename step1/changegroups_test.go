@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestChangeGroupIndex checks entries are found in memory, once spilled, and after a --resume.
+func TestChangeGroupIndex(t *testing.T) {
+	chdirTemp(t)
+	entries := map[string]string{
+		"1":       "10",
+		"2":       "20",
+		"1000000": "30",
+		"0":       "0",
+		"abc":     "40",   // can't be spilled, kept in the checkpoint instead
+		"5":       "RT-1", // nor can this
+	}
+	check := func(t *testing.T, x *changeGroupIndex) {
+		t.Helper()
+		for group, want := range entries {
+			if got, err := x.find(group); err != nil || got != want {
+				t.Errorf("find(%q) got %q, %v, want %q", group, got, err, want)
+			}
+		}
+		for _, group := range []string{"3", "999999999", "def", ""} {
+			if got, err := x.find(group); err != nil || got != "" {
+				t.Errorf("find(%q) got %q, %v, want nothing", group, got, err)
+			}
+		}
+	}
+
+	x := newChangeGroupIndex(false)
+	for group, issue := range entries {
+		if err := x.add(group, issue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("in memory", func(t *testing.T) {
+		check(t, x)
+		if len(x.others) != 2 {
+			t.Errorf("got %v entries that can't be spilled, want 2", len(x.others))
+		}
+	})
+
+	// as add does when memory is full
+	if err := x.save(); err != nil {
+		t.Fatal(err)
+	}
+	clear(x.memory)
+	t.Run("spilled", func(t *testing.T) {
+		check(t, x)
+		if len(x.unsaved) != 0 {
+			t.Errorf("got %v unsaved, want 0", len(x.unsaved))
+		}
+	})
+
+	// as a checkpoint then --resume does
+	others := x.others
+	if err := x.spill.Close(); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("resumed", func(t *testing.T) {
+		resumed := newChangeGroupIndex(true)
+		resumed.others = others
+		check(t, resumed)
+		if _, err := resumed.issue("3"); err != nil || resumed.missed != 1 {
+			t.Errorf("got %v missed, %v, want 1", resumed.missed, err)
+		}
+		if err := resumed.close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(changeGroupSpillFile); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("want %v deleted, got %v", changeGroupSpillFile, err)
+		}
+	})
+
+	t.Run("not resumed", func(t *testing.T) {
+		if err := os.WriteFile(changeGroupSpillFile, []byte("\x0b\x00\x00\x00\x00\x00\x00\x00"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fresh := newChangeGroupIndex(false)
+		if got, err := fresh.find("0"); err != nil || got != "" {
+			t.Errorf("find(\"0\") got %q, %v, want the last run's spill file ignored", got, err)
+		}
+		if err := fresh.add("1", "10"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fresh.save(); err != nil {
+			t.Fatal(err)
+		}
+		clear(fresh.memory)
+		if got, err := fresh.find("0"); err != nil || got != "" {
+			t.Errorf("find(\"0\") got %q, %v, want the last run's spill file emptied", got, err)
+		}
+		if err := fresh.close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
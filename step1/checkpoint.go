@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// checkpointFile is how far step1 got, so an interrupted run can be resumed with --resume
+	checkpointFile string = "_tmp/checkpoint.json"
+)
+
+var (
+	// checkpointInterval is how often to write the checkpoint. A var so a test can write one at every element.
+	checkpointInterval time.Duration = 30 * time.Second
+)
+
+// checkpoint is a point between two elements where everything before has been written out.
+type checkpoint struct {
+	Input             string // the file being split
+	Filter            string `json:",omitempty"` // --project etc., see issueFilter
+	Offset            int64  // in the sanitized input, see sanitizer
+	RemainderLength   int64
+	ManifestLength    int64
+	FallbackIdsLength int64             // see fallbackIds
+	ChangeGroups      map[string]string `json:",omitempty"` // those that can't be spilled, see changeGroupIndex
+	Quarantined       []string          `json:",omitempty"` // rows of the report, see quarantine
+}
+
+func readCheckpoint(fileName string, filter string) (*checkpoint, error) {
+	content, err := os.ReadFile(checkpointFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no %v to resume from, did step1 already finish?", checkpointFile)
+		}
+		return nil, err
+	}
+	var cp checkpoint
+	err = json.Unmarshal(content, &cp)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", checkpointFile, err)
+	}
+	if cp.Input != fileName {
+		return nil, fmt.Errorf("%v is for %v, not %v", checkpointFile, cp.Input, fileName)
+	}
+	if cp.Filter != filter {
+		return nil, fmt.Errorf("%v was made with filters %q, not %q, resume with the same ones", checkpointFile, cp.Filter, filter)
+	}
+	return &cp, nil
+}
+
+// write replaces the checkpoint file, via a temporary file so there is always a whole one.
+func (cp *checkpoint) write() error {
+	content, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := checkpointFile + ".tmp"
+	err = os.WriteFile(tmp, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, checkpointFile)
+}
+
+// openToResume opens a file written by an interrupted run, throwing away anything after length.
+func openToResume(name string, length int64) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() < length {
+		err = fmt.Errorf("%v is %v bytes, shorter than the %v in %v", name, info.Size(), length, checkpointFile)
+	}
+	if err == nil {
+		err = f.Truncate(length)
+	}
+	if err == nil {
+		_, err = f.Seek(length, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resumeEntities has what a checkpoint has to carry over: made up ids, a ChangeGroup that can't be spilled
+// and quarantined elements, both before and after where the split is interrupted.
+const resumeEntities = `<?xml version="1.0" encoding="UTF-8"?>
+<entity-engine-xml>
+    <Action id="1" issue="10" author="admin" type="comment" body="one` + "\x1d" + `two"/>
+    <ChangeGroup id="2" issue="10"/>
+    <ChangeGroup id="x2" issue="10"/>
+    <Label issue="10" label="red"/>
+    <Label issue="" label="blue"/>
+    <Label issue="11" label="green"/>
+    <Label issue="11" label="green"/>
+    <ChangeItem id="3" group="2" field="status"/>
+    <ChangeItem id="4" group="x2" field="status"/>
+    <Label issue="" label="blue"/>
+    <OSPropertyEntry id="5" entityName="jira.properties"/>
+    <Issue id="10" projectKey="RT" number="1"/>
+    <Issue id="11" projectKey="RT" number="2"/>
+</entity-engine-xml>
+`
+
+// TestResume checks a split that is interrupted, then resumed, gives the same files and manifest as one that isn't.
+func TestResume(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	input := writeInput(t, resumeEntities)
+	if err := run(input, "out", testOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := readSplit(t, "out")
+
+	// a checkpoint before every element, and a file in the way of the first Label of issue 11
+	interval := checkpointInterval
+	checkpointInterval = 0
+	t.Cleanup(func() { checkpointInterval = interval })
+	input = writeInput(t, resumeEntities)
+	if err := ensureDirExists("out/Issue/11"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("out/Issue/11", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(input, "out", testOptions(t)); err == nil {
+		t.Fatal("want the split to fail at issue 11")
+	}
+	if _, err := os.Stat(checkpointFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("out/Issue/11"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions(t)
+	opts.resume = true
+	if err := run(input, "out", opts); err != nil {
+		t.Fatal(err)
+	}
+	got := readSplit(t, "out")
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%v after resuming is\n%v\nwant\n%v", name, got[name], content)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%v after resuming, want no such file", name)
+		}
+	}
+	if err := verify(input, "out"); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+// readSplit is what a split wrote: the output files, the remainder and the manifest, by name.
+func readSplit(t *testing.T, output string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for _, name := range []string{remainderFile, manifestFile} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(b)
+	}
+	err := filepath.WalkDir(output, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		files[name] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
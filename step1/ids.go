@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	// fallbackIdsFile lists the ids made so far, one per line, so a --resume can carry on from them
+	fallbackIdsFile string = "_tmp/fallbackids.txt"
+)
+
+// fallbackIds makes up ids for elements that don't have one, from what they contain,
+// so the same element gets the same filename every run and in the next backup.
+// If kept, each id made is appended to fallbackIdsFile and the checkpoint has its length,
+// so a --resume carries on numbering identical elements without a checkpoint rewriting them all.
+type fallbackIds struct {
+	used    map[string]int // how many times each id was made
+	file    *os.File       // nil if not kept
+	journal *bufio.Writer
+	length  int64 // of fallbackIdsFile
+}
+
+func newFallbackIds() *fallbackIds {
+	return &fallbackIds{used: make(map[string]int)}
+}
+
+// keep the ids made in fallbackIdsFile. When resuming, those in its first length bytes are used again
+// and anything after is thrown away.
+func (f *fallbackIds) keep(resuming bool, length int64) error {
+	var err error
+	if resuming {
+		var content []byte
+		content, err = os.ReadFile(fallbackIdsFile)
+		if err != nil {
+			return err
+		}
+		// openToResume checks it's long enough
+		for _, id := range bytes.Split(content[:min(length, int64(len(content)))], []byte("\n")) {
+			if len(id) != 0 {
+				f.used[string(id)]++
+			}
+		}
+		f.file, err = openToResume(fallbackIdsFile, length)
+	} else {
+		f.file, err = os.Create(fallbackIdsFile)
+	}
+	if err != nil {
+		return err
+	}
+	f.journal = bufio.NewWriter(f.file)
+	f.length = length
+	return nil
+}
+
+// make an id from a hash of the parts, e.g. _3fa94c0b12de.
+// Identical elements would get the same id, so the second gets _3fa94c0b12de-2 and so on.
+func (f *fallbackIds) make(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		// so "ab","c" and "a","bc" differ
+		h.Write([]byte{0})
+	}
+	id := fmt.Sprintf("_%x", h.Sum(nil)[:6])
+	f.used[id]++
+	if f.journal != nil {
+		// an error is kept by the writer, for flush
+		n, _ := fmt.Fprintln(f.journal, id)
+		f.length += int64(n)
+	}
+	if n := f.used[id]; n > 1 {
+		id = fmt.Sprintf("%v-%v", id, n)
+	}
+	return id
+}
+
+// forElement makes an id from the element's name and attributes, in name order.
+func (f *fallbackIds) forElement(el xml.StartElement) string {
+	attrs := make([]string, 0, len(el.Attr))
+	for _, a := range el.Attr {
+		attrs = append(attrs, fmt.Sprintf("%v:%v=%v", a.Name.Space, a.Name.Local, a.Value))
+	}
+	sort.Strings(attrs)
+	return f.make(append([]string{el.Name.Space, el.Name.Local}, attrs...)...)
+}
+
+// flush writes out the ids made so far, for a checkpoint.
+func (f *fallbackIds) flush() error {
+	if f.journal == nil {
+		return nil
+	}
+	return f.journal.Flush()
+}
+
+// close fallbackIdsFile, keeping it for a --resume.
+func (f *fallbackIds) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.flush()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	f.file, f.journal = nil, nil
+	return err
+}
+
+// finish closes fallbackIdsFile and deletes it, it's no use once step1 is finished.
+func (f *fallbackIds) finish() error {
+	err := f.close()
+	if rerr := os.Remove(fallbackIdsFile); err == nil && !errors.Is(rerr, os.ErrNotExist) {
+		err = rerr
+	}
+	return err
+}
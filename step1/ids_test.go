@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFallbackIds(t *testing.T) {
+	ids := newFallbackIds()
+	base := ids.make("Label", "issue=10")
+	if len(base) != 13 || base[0] != '_' {
+		t.Errorf("got %q, want _ and 12 hex digits", base)
+	}
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{"second identical", []string{"Label", "issue=10"}, base + "-2"},
+		{"third identical", []string{"Label", "issue=10"}, base + "-3"},
+		{"parts split differently", []string{"Labe", "lissue=10"}, ""},
+		{"another", []string{"Label", "issue=11"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids.make(tt.parts...)
+			if tt.want == "" && (got == base || strings.HasPrefix(got, base+"-")) {
+				t.Errorf("got %q, want a different id", got)
+			} else if tt.want != "" && got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("attribute order doesn't matter", func(t *testing.T) {
+		a := newFallbackIds().forElement(startElement(t, `<Label issue="10" label="red"/>`))
+		b := newFallbackIds().forElement(startElement(t, `<Label label="red" issue="10"/>`))
+		if a != b {
+			t.Errorf("got %q and %q, want the same", a, b)
+		}
+	})
+}
+
+// TestFallbackIdsResume checks a --resume numbers identical elements on from the checkpoint,
+// forgetting the ids made after it.
+func TestFallbackIdsResume(t *testing.T) {
+	chdirTemp(t)
+	if err := ensureDirExists(fallbackIdsFile); err != nil {
+		t.Fatal(err)
+	}
+	ids := newFallbackIds()
+	if err := ids.keep(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	base := ids.make("a")
+	ids.make("a")
+	other := ids.make("b")
+	// a checkpoint
+	if err := ids.flush(); err != nil {
+		t.Fatal(err)
+	}
+	length := ids.length
+	if got := ids.make("a"); got != base+"-3" {
+		t.Errorf("got %q, want %q", got, base+"-3")
+	}
+	// interrupted
+	if err := ids.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := newFallbackIds()
+	if err := resumed.keep(true, length); err != nil {
+		t.Fatal(err)
+	}
+	if got := resumed.make("a"); got != base+"-3" {
+		t.Errorf("after resuming got %q, want %q", got, base+"-3")
+	}
+	if got := resumed.make("b"); got != other+"-2" {
+		t.Errorf("after resuming got %q, want %q", got, other+"-2")
+	}
+	if err := resumed.flush(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fallbackIdsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%v\n%v\n%v\n%v\n%v\n", base, base, other, base, other)
+	if string(b) != want || resumed.length != int64(len(want)) {
+		t.Errorf("got %q (length %v), want %q", b, resumed.length, want)
+	}
+	if err = resumed.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(fallbackIdsFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("want %v deleted, got %v", fallbackIdsFile, err)
+	}
+
+	t.Run("checkpoint longer than the file", func(t *testing.T) {
+		if err := os.WriteFile(fallbackIdsFile, []byte(base+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := newFallbackIds().keep(true, 100); err == nil {
+			t.Error("want an error")
+		}
+	})
+}
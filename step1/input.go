@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	entitiesFile      string = "entities.xml"
+	activeObjectsFile string = "activeobjects.xml"
+)
+
+// openEntities opens entities.xml, or streams it out of a JIRA backup .zip without extracting it.
+func openEntities(fileName string) (io.ReadCloser, error) {
+	if !isZip(fileName) {
+		return os.Open(fileName)
+	}
+	return openZipEntry(fileName, entitiesFile)
+}
+
+// entitiesSize is the size of entities.xml, uncompressed if it's in a .zip.
+func entitiesSize(fileName string) (int64, error) {
+	if !isZip(fileName) {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	z, err := zip.OpenReader(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer z.Close()
+	for _, f := range z.File {
+		if f.Name == entitiesFile {
+			return int64(f.UncompressedSize64), nil
+		}
+	}
+	return 0, fmt.Errorf("%v: no %v in the zip: %w", fileName, entitiesFile, fs.ErrNotExist)
+}
+
+// openActiveObjects opens the activeobjects.xml from the backup .zip, or next to entities.xml.
+// The error wraps fs.ErrNotExist if there isn't one.
+func openActiveObjects(fileName string) (io.ReadCloser, error) {
+	if !isZip(fileName) {
+		return os.Open(filepath.Join(filepath.Dir(fileName), activeObjectsFile))
+	}
+	return openZipEntry(fileName, activeObjectsFile)
+}
+
+func isZip(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".zip")
+}
+
+func openZipEntry(fileName string, name string) (io.ReadCloser, error) {
+	z, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range z.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				z.Close()
+				return nil, err
+			}
+			return zipEntry{ReadCloser: rc, zip: z}, nil
+		}
+	}
+	z.Close()
+	return nil, fmt.Errorf("%v: no %v in the zip: %w", fileName, name, fs.ErrNotExist)
+}
+
+// zipEntry closes the zip along with the entry.
+type zipEntry struct {
+	io.ReadCloser
+	zip *zip.ReadCloser
+}
+
+func (z zipEntry) Close() error {
+	err := z.ReadCloser.Close()
+	if zerr := z.zip.Close(); err == nil {
+		err = zerr
+	}
+	return err
+}
+
+// recorder keeps what has been read from r since the last take(),
+// so we can copy out byte ranges of the input when it can't be seeked.
+//
+// It implements io.ByteReader so that xml.Decoder reads through it without adding its own buffer,
+// which means the decoder's InputOffset() is never ahead of what we've recorded.
+type recorder struct {
+	r     *bufio.Reader
+	buf   []byte
+	start int64 // input offset of buf[0]
+}
+
+func newRecorder(r *bufio.Reader) *recorder {
+	return &recorder{r: r}
+}
+
+func (r *recorder) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.buf = append(r.buf, b)
+	}
+	return b, err
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// offset is how many bytes have been read.
+func (r *recorder) offset() int64 {
+	return r.start + int64(len(r.buf))
+}
+
+// skipTo discards the input up to offset without recording it.
+// Nothing after the current offset can have been recorded yet.
+func (r *recorder) skipTo(offset int64) error {
+	if offset < r.offset() || len(r.buf) != 0 {
+		return fmt.Errorf("can't skip to %v, have %v-%v", offset, r.start, r.offset())
+	}
+	n, err := r.r.Discard(int(offset - r.start))
+	r.start += int64(n)
+	if err != nil {
+		return fmt.Errorf("input ends at %v, before %v: %w", r.start, offset, err)
+	}
+	return nil
+}
+
+// take returns the input between startPos and endPos, and forgets everything before endPos.
+func (r *recorder) take(startPos int64, endPos int64) ([]byte, error) {
+	if startPos < r.start || endPos > r.offset() || startPos > endPos {
+		return nil, fmt.Errorf("can't take %v-%v, have %v-%v", startPos, endPos, r.start, r.offset())
+	}
+	content := make([]byte, endPos-startPos)
+	copy(content, r.buf[startPos-r.start:endPos-r.start])
+	r.buf = r.buf[endPos-r.start:]
+	r.start = endPos
+	return content, nil
+}
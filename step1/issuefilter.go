@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// issueAttributes are the attributes that, if an element has one, hold the id of the issue it belongs to.
+	issueAttributes []string = []string{"issue", "issue_id", "issueId", "issueid"}
+	// issueNodes are the ends of an association, e.g. UserAssociation (watchers, votes) and
+	// NodeAssociation (fix and affects versions, components). The id is an issue's if the entity is Issue.
+	issueNodes []struct{ entity, id string } = []struct{ entity, id string }{
+		{"sourceNodeEntity", "sourceNodeId"},
+		{"sinkNodeEntity", "sinkNodeId"},
+	}
+	// issueLinkEnds are the issues an IssueLink joins, it's kept if either is
+	issueLinkEnds []string = []string{"source", "destination"}
+	// afterLayouts are what --created-after and --updated-after accept
+	afterLayouts []string = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"}
+)
+
+// issueFilter keeps only the issues in some projects and/or created or updated on or after a date,
+// for --project, --created-after and --updated-after, along with everything that belongs to them:
+// actions, change groups and items, worklogs, attachments, custom field values, watchers, versions etc.
+// IssueLinks are kept if either issue is. Other entities, e.g. projects and users, are all kept.
+//
+// JIRA writes the elements in alphabetical order, so Actions, ChangeGroups etc. come before their Issue.
+// The input is read once first, by scan, to find the issues to keep.
+type issueFilter struct {
+	projects     map[string]bool // project keys, empty for all
+	createdAfter string          // as a JIRA timestamp, which sort as strings; "" for any
+	updatedAfter string
+
+	issues  map[string]bool // the ids of the issues to keep, from scan
+	skipped map[string]int  // element types that were skipped
+}
+
+// newIssueFilter returns nil if there is nothing to filter on.
+func newIssueFilter(projects []string, createdAfter string, updatedAfter string) (*issueFilter, error) {
+	if len(projects) == 0 && createdAfter == "" && updatedAfter == "" {
+		return nil, nil
+	}
+	f := issueFilter{
+		projects: make(map[string]bool),
+		skipped:  make(map[string]int),
+	}
+	for _, p := range projects {
+		f.projects[p] = true
+	}
+	var err error
+	if f.createdAfter, err = parseAfter("--created-after", createdAfter); err != nil {
+		return nil, err
+	}
+	if f.updatedAfter, err = parseAfter("--updated-after", updatedAfter); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// parseAfter turns a date, with or without a time, into a JIRA timestamp.
+func parseAfter(flag string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	for _, layout := range afterLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02 15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("%v %q: want a date like 2020-01-31 or 2020-01-31 13:45", flag, value)
+}
+
+// String is the filter as flags, to check a --resume uses the same ones.
+func (f *issueFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	var parts []string
+	projects := make([]string, 0, len(f.projects))
+	for p := range f.projects {
+		projects = append(projects, p)
+	}
+	sort.Strings(projects)
+	for _, p := range projects {
+		parts = append(parts, fmt.Sprintf("--project %v", p))
+	}
+	if f.createdAfter != "" {
+		parts = append(parts, fmt.Sprintf("--created-after %q", f.createdAfter))
+	}
+	if f.updatedAfter != "" {
+		parts = append(parts, fmt.Sprintf("--updated-after %q", f.updatedAfter))
+	}
+	return strings.Join(parts, " ")
+}
+
+// scan reads the input to find the issues to keep.
+func (f *issueFilter) scan(fileName string, escape string) error {
+	started := time.Now()
+	log.Printf("finding the issues to keep (%v)", f)
+	in, err := openEntities(fileName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Like turnRecordsIntoFiles, but the replacements are logged then
+	s := newSanitizer(in, escape)
+	s.quiet = true
+	d := xml.NewDecoder(bufio.NewReaderSize(s, 1024*1024))
+	d.Strict = false
+
+	f.issues = make(map[string]bool)
+	var total int
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Local == "entity-engine-xml" {
+			continue
+		}
+		if start.Name.Local == "Issue" {
+			total++
+			attrs := makeAttributes(start)
+			if id, err := attrs.value("id"); err == nil && f.matches(attrs) {
+				f.issues[id] = true
+			}
+		}
+		err = d.Skip()
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("keeping %v of %v issues, found in %v", len(f.issues), total, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// matches says if an Issue element is one to keep.
+func (f *issueFilter) matches(attrs attributes) bool {
+	if len(f.projects) > 0 {
+		key, _ := attrs.value("projectKey")
+		if !f.projects[key] {
+			return false
+		}
+	}
+	if f.createdAfter != "" {
+		created, _ := attrs.value("created")
+		if created < f.createdAfter {
+			return false
+		}
+	}
+	if f.updatedAfter != "" {
+		updated, _ := attrs.value("updated")
+		if updated < f.updatedAfter {
+			return false
+		}
+	}
+	return true
+}
+
+// skips says if the element belongs only to issues that aren't kept, and counts it if so.
+// Under a filter only the kept ChangeGroups are indexed, so a ChangeItem whose group isn't found is skipped.
+func (f *issueFilter) skips(el xml.StartElement, changeGroups *changeGroupIndex) (bool, error) {
+	issues, err := issuesOf(el, changeGroups)
+	if err != nil || issues == nil {
+		// nil if it isn't part of an issue
+		return false, err
+	}
+	for _, issue := range issues {
+		if f.issues[issue] {
+			return false, nil
+		}
+	}
+	f.skipped[el.Name.Local]++
+	return true, nil
+}
+
+// issuesOf are the ids of the issues an element belongs to, or nil if it isn't part of an issue.
+func issuesOf(el xml.StartElement, changeGroups *changeGroupIndex) ([]string, error) {
+	attrs := makeAttributes(el)
+	switch el.Name.Local {
+	case "Issue", "IssueView":
+		issue, _ := attrs.value("id")
+		return []string{issue}, nil
+	case "ChangeItem":
+		group, err := attrs.get("group")
+		if err != nil {
+			// it will be quarantined
+			return nil, nil
+		}
+		issue, err := changeGroups.find(group)
+		return []string{issue}, err
+	case "IssueLink":
+		var issues []string
+		for _, a := range issueLinkEnds {
+			issue, _ := attrs.value(a)
+			issues = append(issues, issue)
+		}
+		return issues, nil
+	}
+	for _, a := range issueAttributes {
+		if attrs.contains(a) {
+			issue, _ := attrs.value(a)
+			return []string{issue}, nil
+		}
+	}
+	var issues []string
+	for _, n := range issueNodes {
+		if entity, _ := attrs.value(n.entity); entity == "Issue" {
+			issue, _ := attrs.value(n.id)
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// skipsIssue says if an element of the issue with this id isn't kept, and counts it if so.
+func (f *issueFilter) skipsIssue(element string, issue string) bool {
+	if f.issues[issue] {
+		return false
+	}
+	f.skipped[element]++
+	return true
+}
+
+// logSkipped summarises which element types were skipped.
+func (f *issueFilter) logSkipped() {
+	names := make([]string, 0, len(f.skipped))
+	total := 0
+	for name, n := range f.skipped {
+		names = append(names, name)
+		total += n
+	}
+	sort.Strings(names)
+	log.Printf("%v elements of other issues were skipped:", total)
+	for _, name := range names {
+		log.Printf("  %v: %v", name, f.skipped[name])
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIssueFilterMatches(t *testing.T) {
+	issues := map[string]string{
+		"old": `<Issue id="1" projectKey="RT" created="2019-12-31 23:59:59.0" updated="2020-02-01 09:00:00.0"/>`,
+		"new": `<Issue id="2" projectKey="RT" created="2020-01-31 00:00:00.0" updated="2020-01-31 13:45:00.0"/>`,
+		"oth": `<Issue id="3" projectKey="OTH" created="2020-03-01 00:00:00.0"/>`,
+	}
+	tests := []struct {
+		name         string
+		projects     []string
+		createdAfter string
+		updatedAfter string
+		want         []string
+	}{
+		{"project", []string{"RT"}, "", "", []string{"new", "old"}},
+		{"projects", []string{"RT", "OTH"}, "", "", []string{"new", "oth", "old"}},
+		{"created on the day", nil, "2020-01-31", "", []string{"new", "oth"}},
+		{"created after a time", nil, "2020-01-31 00:01", "", []string{"oth"}},
+		{"updated at the second", nil, "", "2020-01-31 13:45:00", []string{"new", "old"}},
+		{"updated, where it's missing", nil, "", "2020-01-01", []string{"new", "old"}},
+		{"project and date", []string{"RT"}, "2020-01-01", "", []string{"new"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newIssueFilter(tt.projects, tt.createdAfter, tt.updatedAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, name := range []string{"new", "oth", "old"} {
+				if f.matches(makeAttributes(startElement(t, issues[name]))) {
+					got = append(got, name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if f, err := newIssueFilter(nil, "", ""); f != nil || err != nil {
+		t.Errorf("with no flags got %v, %v, want no filter", f, err)
+	}
+	if _, err := newIssueFilter(nil, "31/01/2020", ""); err == nil {
+		t.Error("want an error for a date JIRA doesn't write")
+	}
+}
+
+func TestIssueFilterSkips(t *testing.T) {
+	f, err := newIssueFilter([]string{"RT"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.issues = map[string]bool{"10": true}
+	changeGroups := newChangeGroupIndex(false)
+	if err = changeGroups.add("2", "10"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		element string
+		want    bool
+	}{
+		{`<Issue id="10" projectKey="RT"/>`, false},
+		{`<Issue id="20" projectKey="OTH"/>`, true},
+		{`<IssueView id="20"/>`, true},
+		{`<Action id="1" issue="10"/>`, false},
+		{`<Action id="2" issue="20"/>`, true},
+		{`<CustomFieldValue id="3" issue="20" customfield="5"/>`, true},
+		{`<AO_60DB71_ISSUERANKING><ID>1</ID></AO_60DB71_ISSUERANKING>`, false},
+		{`<ChangeItem id="4" group="2"/>`, false},
+		{`<ChangeItem id="5" group="3"/>`, true},
+		{`<ChangeItem id="6"/>`, false},
+		{`<IssueLink id="7" source="20" destination="10"/>`, false},
+		{`<IssueLink id="8" source="20" destination="21"/>`, true},
+		{`<UserAssociation sourceName="jsmith" sinkNodeId="20" sinkNodeEntity="Issue"/>`, true},
+		{`<NodeAssociation sourceNodeId="10" sourceNodeEntity="Issue" sinkNodeId="1" sinkNodeEntity="Version"/>`, false},
+		{`<NodeAssociation sourceNodeId="1" sourceNodeEntity="Project" sinkNodeId="2" sinkNodeEntity="Version"/>`, false},
+		{`<Project id="1" key="OTH"/>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.element, func(t *testing.T) {
+			got, err := f.skips(startElement(t, tt.element), changeGroups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("skips got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const filterEntities = `<?xml version="1.0" encoding="UTF-8"?>
+<entity-engine-xml>
+    <Action id="1" issue="10" type="comment" body="kept"/>
+    <Action id="2" issue="20" type="comment" body="skipped"/>
+    <ChangeGroup id="3" issue="20"/>
+    <ChangeItem id="4" group="3" field="status"/>
+    <Issue id="10" projectKey="RT" number="1" created="2020-01-02 10:00:00.0"/>
+    <Issue id="20" projectKey="OTH" number="1" created="2020-01-02 10:00:00.0"/>
+    <IssueLink id="5" source="10" destination="20" linktype="1"/>
+    <Project id="1" key="OTH"/>
+</entity-engine-xml>
+`
+
+// TestIssueFilterSplit checks the other issues' elements aren't written, but are in the manifest as skipped.
+func TestIssueFilterSplit(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	input := writeInput(t, filterEntities)
+	opts := testOptions(t)
+	var err error
+	opts.issues, err = newIssueFilter([]string{"RT"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = run(input, "out", opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Issue/10/RT-1.xml", "Issue/10/Action/1.xml", "IssueLinkType/1/IssueLink/5.xml", "Project/1/OTH.xml"} {
+		if _, err := os.Stat(filepath.Join("out", name)); err != nil {
+			t.Errorf("want %v kept: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("out", "Issue/20")); !os.IsNotExist(err) {
+		t.Errorf("want Issue/20 skipped, got %v", err)
+	}
+
+	entries, _, err := readManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []string
+	for _, e := range entries {
+		if e.file == skippedDest {
+			skipped = append(skipped, strings.TrimSpace(filterEntities[e.start:e.end]))
+		}
+	}
+	want := []string{
+		`<Action id="2" issue="20" type="comment" body="skipped"/>`,
+		`<ChangeGroup id="3" issue="20"/>`,
+		`<ChangeItem id="4" group="3" field="status"/>`,
+		`<Issue id="20" projectKey="OTH" number="1" created="2020-01-02 10:00:00.0"/>`,
+	}
+	if strings.Join(skipped, "\n") != strings.Join(want, "\n") {
+		t.Errorf("skipped\n%v\nwant\n%v", strings.Join(skipped, "\n"), strings.Join(want, "\n"))
+	}
+	if err = verify(input, "out"); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
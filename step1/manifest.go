@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// manifestFile records where every byte of entities.xml was written, see splitOutput
+	manifestFile string = "_tmp/manifest.tsv"
+	// remainderDest is the manifest's name for the remainder file
+	remainderDest string = "-"
+	// skippedDest is the manifest's name for input that wasn't written anywhere, see issueFilter
+	skippedDest string = "*"
+)
+
+// manifestEntry says a range of the input was written to a file.
+type manifestEntry struct {
+	start      int64 // input offset
+	end        int64
+	file       string // relative to the output dir, or remainderDest
+	fileOffset int64  // where in the file it was written
+}
+
+// splitOutput writes portions of the input either to their own file or the remainder,
+// noting in the manifest where each came from.
+// The remainder is written in order, files may be written later by the sink.
+type splitOutput struct {
+	sink         sink
+	remainder    *bufio.Writer
+	remainderPos int64
+	manifest     *bufio.Writer
+	manifestPos  int64
+}
+
+func (o *splitOutput) toRemainder(start int64, content []byte) error {
+	if len(content) == 0 {
+		return nil
+	}
+	_, err := o.remainder.Write(content)
+	if err != nil {
+		return err
+	}
+	err = o.record(manifestEntry{start, start + int64(len(content)), remainderDest, o.remainderPos})
+	o.remainderPos += int64(len(content))
+	return err
+}
+
+// skip notes that the input from start to end was left out on purpose.
+func (o *splitOutput) skip(start int64, end int64) error {
+	return o.record(manifestEntry{start, end, skippedDest, 0})
+}
+
+func (o *splitOutput) toFile(start int64, name string, content []byte) error {
+	err := o.sink.write(name, content)
+	if err != nil {
+		return err
+	}
+	return o.record(manifestEntry{start, start + int64(len(content)), name, 0})
+}
+
+// start notes the escape the sanitizer uses, first, so even an interrupted run's manifest says
+// its offsets are of the sanitized input. The escape may be empty, which still means sanitized.
+func (o *splitOutput) start(escape string) error {
+	n, err := fmt.Fprintf(o.manifest, "#\tescape\t-\t%s\n", escape)
+	o.manifestPos += int64(n)
+	return err
+}
+
+// finish notes the size and checksum of the whole input, so it can be checked when reassembled,
+// and the illegal characters the sanitizer replaced, so they can be put back.
+// The offsets in the manifest are of the sanitized input.
+func (o *splitOutput) finish(s *sanitizer, sha256 []byte) error {
+	for _, r := range s.replaced {
+		n, err := fmt.Fprintf(o.manifest, "#\treplaced\t%d\t%d %x\n", r.offset, r.length, r.original)
+		o.manifestPos += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := fmt.Fprintf(o.manifest, "#\tsha256\t%x\t%d\n", sha256, s.inPos)
+	o.manifestPos += int64(n)
+	return err
+}
+
+// activeObjectsReplaced notes the illegal characters replaced in activeobjects.xml, at their offsets in it.
+// Its rows aren't copied byte for byte, so this is only a record of what was changed.
+func (o *splitOutput) activeObjectsReplaced(s *sanitizer) error {
+	for _, r := range s.replaced {
+		n, err := fmt.Fprintf(o.manifest, "#\t%v\t%d\t%d %x\n", activeObjectsFile, r.offset, r.length, r.original)
+		o.manifestPos += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *splitOutput) record(e manifestEntry) error {
+	n, err := fmt.Fprintf(o.manifest, "%d\t%d\t%d\t%s\n", e.start, e.end, e.fileOffset, e.file)
+	o.manifestPos += int64(n)
+	return err
+}
+
+// flush waits until everything so far is written.
+func (o *splitOutput) flush() error {
+	err := o.sink.flush()
+	if rerr := o.remainder.Flush(); err == nil {
+		err = rerr
+	}
+	if merr := o.manifest.Flush(); err == nil {
+		err = merr
+	}
+	return err
+}
+
+// manifestSummary is what the manifest says about the whole input.
+type manifestSummary struct {
+	size      int64  // of the original
+	sha256    string // of the original, in hex, "" if step1 didn't finish
+	sanitized bool   // if the offsets are of the sanitized input
+	escape    string // that the sanitizer used, which may be ""
+	replaced  []replacement
+}
+
+// readManifest returns the entries and the summary, which is only partly filled in if step1 didn't finish.
+func readManifest(name string) ([]manifestEntry, *manifestSummary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var (
+		entries []manifestEntry
+		summary manifestSummary
+	)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			return nil, nil, fmt.Errorf("%v:%v: want 4 fields, got %v", name, line, len(fields))
+		}
+		if fields[0] == "#" {
+			switch fields[1] {
+			case "escape":
+				summary.sanitized = true
+				summary.escape = fields[3]
+			case "replaced":
+				var r replacement
+				_, err = fmt.Sscanf(fields[2]+" "+fields[3], "%d %d %x", &r.offset, &r.length, &r.original)
+				summary.replaced = append(summary.replaced, r)
+			case "sha256":
+				summary.sha256 = fields[2]
+				summary.size, err = strconv.ParseInt(fields[3], 10, 64)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%v:%v: %w", name, line, err)
+			}
+			continue
+		}
+		var e manifestEntry
+		e.file = fields[3]
+		for i, n := range []*int64{&e.start, &e.end, &e.fileOffset} {
+			*n, err = strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%v:%v: %w", name, line, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, &summary, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	// progressInterval is how often to log progress
+	progressInterval time.Duration = 5 * time.Second
+	mb               float64       = 1024 * 1024
+)
+
+// elementStats are the totals for one type of element.
+type elementStats struct {
+	count int
+	bytes int64
+}
+
+// progress logs how far through the input we are, and totals by element type at the end.
+type progress struct {
+	size       int64 // of the input, 0 if not known
+	from       int64 // offset we started at, when resuming
+	started    time.Time
+	lastReport time.Time
+
+	elements int
+	files    int
+	stats    map[string]*elementStats
+}
+
+func newProgress(size int64, from int64) *progress {
+	now := time.Now()
+	return &progress{
+		size:       size,
+		from:       from,
+		started:    now,
+		lastReport: now,
+		stats:      make(map[string]*elementStats),
+	}
+}
+
+// element counts an element, and logs progress now and then.
+// offset is how far through the input we are.
+func (p *progress) element(name string, bytes int, toFile bool, offset int64) {
+	p.elements++
+	if toFile {
+		p.files++
+	}
+	s, ok := p.stats[name]
+	if !ok {
+		s = &elementStats{}
+		p.stats[name] = s
+	}
+	s.count++
+	s.bytes += int64(bytes)
+
+	if now := time.Now(); now.Sub(p.lastReport) >= progressInterval {
+		p.lastReport = now
+		p.report(offset, now)
+	}
+}
+
+func (p *progress) report(offset int64, now time.Time) {
+	elapsed := now.Sub(p.started).Seconds()
+	rate := float64(offset-p.from) / elapsed
+	line := fmt.Sprintf("%.1f MB", float64(offset)/mb)
+	if p.size > 0 {
+		// offsets are of the sanitized input, which can be a little bigger
+		percent := min(100*float64(offset)/float64(p.size), 100)
+		line = fmt.Sprintf("%.1f%% %v of %.1f MB", percent, line, float64(p.size)/mb)
+	}
+	line += fmt.Sprintf(", %.1f MB/s, %.0f elements/s, %v files written", rate/mb, float64(p.elements)/elapsed, p.files)
+	if p.size > offset && rate > 0 {
+		eta := time.Duration(float64(p.size-offset) / rate * float64(time.Second))
+		line += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+	}
+	log.Print(line)
+}
+
+// finish logs the final progress and the totals by element type, biggest first.
+func (p *progress) finish(offset int64) {
+	now := time.Now()
+	p.report(offset, now)
+	log.Printf("%v elements, %v files written in %v", p.elements, p.files, now.Sub(p.started).Round(time.Second))
+
+	names := make([]string, 0, len(p.stats))
+	for name := range p.stats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := p.stats[names[i]], p.stats[names[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return names[i] < names[j]
+	})
+	log.Printf("%-40v %10v %14v", "element", "count", "bytes")
+	for _, name := range names {
+		s := p.stats[name]
+		log.Printf("%-40v %10v %14v", name, s.count, s.bytes)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ishepherd/jira-to-markdown/safename"
+)
+
+const (
+	// quarantineDir, in the output, has the elements that couldn't be given a filename
+	quarantineDir string = "_quarantine"
+)
+
+// quarantine is for elements whose filename can't be made, e.g. because they don't have an attribute
+// the routing rule needs. Rather than stopping, they're written to _quarantine/<element>/<offset>.xml
+// and listed in _quarantine/report.tsv with the reason.
+// The report so far is kept in the checkpoint, so after a --resume it still lists them all.
+type quarantine struct {
+	rows   []string       // of the report
+	counts map[string]int // by element and problem
+}
+
+func newQuarantine() *quarantine {
+	return &quarantine{counts: make(map[string]int)}
+}
+
+// add an element starting at offset in the input, giving the filename to write it to.
+func (q *quarantine) add(offset int64, el xml.StartElement, problem *attributeError) string {
+	name := fmt.Sprintf("%v/%v/%v.xml", quarantineDir, safename.Encode(el.Name.Local), offset)
+	q.rows = append(q.rows, fmt.Sprintf("%v\t%v\t%v\t%v", offset, el.Name.Local, name, problem))
+	q.counts[problem.Error()]++
+	return name
+}
+
+// restore the report rows from a checkpoint.
+func (q *quarantine) restore(rows []string) {
+	for _, row := range rows {
+		fields := strings.SplitN(row, "\t", 4)
+		q.counts[fields[len(fields)-1]]++
+	}
+	q.rows = append(q.rows, rows...)
+}
+
+// finish writes the report and logs a summary.
+func (q *quarantine) finish(out sink) error {
+	if len(q.counts) == 0 {
+		return nil
+	}
+	problems := make([]string, 0, len(q.counts))
+	total := 0
+	for problem, n := range q.counts {
+		problems = append(problems, problem)
+		total += n
+	}
+	sort.Strings(problems)
+	log.Printf("%v elements couldn't be given a filename, they are in %v:", total, quarantineDir)
+	for _, problem := range problems {
+		log.Printf("  %v: %v", problem, q.counts[problem])
+	}
+	var report bytes.Buffer
+	report.WriteString("offset\telement\tfile\tproblem\n")
+	for _, row := range q.rows {
+		report.WriteString(row)
+		report.WriteByte('\n')
+	}
+	return out.write(fmt.Sprintf("%v/report.tsv", quarantineDir), report.Bytes())
+}
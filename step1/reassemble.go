@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/ishepherd/jira-to-markdown/archive"
+)
+
+// reassemble puts entities.xml back together from the remainder and output files, using the manifest.
+// The result is checked against the checksum of the original recorded in the manifest.
+func reassemble(outputDir string, fileName string) error {
+	entries, summary, err := readManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if summary.sha256 == "" {
+		return fmt.Errorf("%v has no checksum, did step1 finish?", manifestFile)
+	}
+	for _, e := range entries {
+		if e.file == skippedDest {
+			return fmt.Errorf("%v: step1 left out other issues with --project etc., so the original can't be put back together", manifestFile)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].start < entries[j].start
+	})
+
+	rem, err := os.Open(remainderFile)
+	if err != nil {
+		return err
+	}
+	defer rem.Close()
+	output, closer, err := archive.Open(outputDir)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	bw := bufio.NewWriterSize(io.MultiWriter(f, hash), 1024*1024)
+	// The manifest is of the sanitized input, put the illegal characters back
+	w := &unsanitizer{w: bw, replaced: summary.replaced}
+
+	var pos int64
+	for _, e := range entries {
+		if e.start != pos {
+			return fmt.Errorf("the manifest doesn't cover input bytes %v-%v, try --verify", pos, e.start)
+		}
+		length := e.end - e.start
+		if e.file == remainderDest {
+			_, err = io.Copy(w, io.NewSectionReader(rem, e.fileOffset, length))
+		} else {
+			err = copyRange(w, output, e.file, e.fileOffset, length)
+		}
+		if err != nil {
+			return err
+		}
+		pos = e.end
+	}
+	err = w.finish()
+	if err != nil {
+		return err
+	}
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if w.written != summary.size || sum != summary.sha256 {
+		return fmt.Errorf("%v is not the same as the original: got %v bytes sha256 %v, want %v bytes sha256 %v",
+			fileName, w.written, sum, summary.size, summary.sha256)
+	}
+	log.Printf("%v is identical to the original, %v bytes sha256 %v", fileName, w.written, sum)
+	return nil
+}
+
+func copyRange(w io.Writer, output fs.FS, name string, offset int64, length int64) error {
+	content, err := fs.ReadFile(output, name)
+	if err != nil {
+		return err
+	}
+	if offset+length > int64(len(content)) {
+		return fmt.Errorf("%v: wanted %v bytes at %v, but it is %v bytes", name, length, offset, len(content))
+	}
+	_, err = w.Write(content[offset : offset+length])
+	return err
+}
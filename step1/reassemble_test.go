@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTripEntities has a bit of everything: a prologue comment, boring and routed elements,
+// an element without an id, one that is quarantined and an illegal character.
+const roundTripEntities = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- backup of JIRA -->
+<entity-engine-xml>
+    <Action id="1" issue="10" author="admin" type="comment" body="one` + "\x1d" + `two"/>
+    <ChangeGroup id="2" issue="10" author="admin" created="2020-01-02 10:00:00.0"/>
+    <ChangeItem id="3" group="2" field="status" oldstring="Open" newstring="Done"/>
+    <Label issue="10" label="red"/>
+    <Label issue="" label="blue"/>
+    <OSPropertyEntry id="4" entityName="jira.properties"/>
+    <Issue id="10" projectKey="RT" number="1" project="1" summary="Round trip"/>
+</entity-engine-xml>
+`
+
+// chdirTemp changes to a new temporary dir until the test ends, so the _tmp files go there, and returns it.
+func chdirTemp(tb testing.TB) string {
+	tb.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dir := tb.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// splitForTest splits roundTripEntities into output in a new current dir, returning the name of the input.
+func splitForTest(t *testing.T, output string) string {
+	t.Helper()
+	input := writeInput(t, roundTripEntities)
+	if err := run(input, output, testOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+// writeInput writes entities to a new current dir, returning its name.
+func writeInput(t *testing.T, entities string) string {
+	t.Helper()
+	input := filepath.Join(chdirTemp(t), entitiesFile)
+	if err := os.WriteFile(input, []byte(entities), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+// testOptions are step1's defaults, with the built-in rules and boring elements.
+func testOptions(t *testing.T) options {
+	t.Helper()
+	rules, err := loadRoutingRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newElementFilter("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return options{rules: rules, filter: filter, escape: "{%v}", writers: 2}
+}
+
+// editManifest replaces the manifest's lines with what edit returns.
+func editManifest(t *testing.T, edit func(lines []string) []string) {
+	t.Helper()
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"))
+	if err = os.WriteFile(manifestFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fileLine is the index of the first manifest line for an output file.
+func fileLine(t *testing.T, lines []string) int {
+	t.Helper()
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#") && !strings.HasSuffix(line, "\t"+remainderDest) {
+			return i
+		}
+	}
+	t.Fatal("no output files in the manifest")
+	return 0
+}
+
+// TestRoundTrip checks a split can be reassembled into the same bytes,
+// and that --verify finds bytes that are lost or written twice.
+func TestRoundTrip(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, output string)
+		want   string // in the error from verify, "" for none
+	}{
+		{"intact", func(t *testing.T, output string) {}, ""},
+		{"gap", func(t *testing.T, output string) {
+			editManifest(t, func(lines []string) []string {
+				i := fileLine(t, lines)
+				return append(lines[:i], lines[i+1:]...)
+			})
+		}, "lost"},
+		{"overlap", func(t *testing.T, output string) {
+			editManifest(t, func(lines []string) []string {
+				i := fileLine(t, lines)
+				return append(lines[:i+1], lines[i:]...)
+			})
+		}, "duplicated"},
+		{"deleted", func(t *testing.T, output string) {
+			if filepath.Ext(output) != "" {
+				t.Skip("can't delete from an archive")
+			}
+			if err := os.Remove(filepath.Join(output, "Issue/10/RT-1.xml")); err != nil {
+				t.Fatal(err)
+			}
+		}, "missing"},
+	}
+	for _, output := range []string{"out", "out.zip"} {
+		for _, tt := range tests {
+			t.Run(output+"/"+tt.name, func(t *testing.T) {
+				input := splitForTest(t, output)
+				tt.damage(t, output)
+				err := verify(input, output)
+				if tt.want == "" {
+					if err != nil {
+						t.Fatalf("verify: %v", err)
+					}
+					if err = reassemble(output, "reassembled.xml"); err != nil {
+						t.Fatalf("reassemble: %v", err)
+					}
+					got, err := os.ReadFile("reassembled.xml")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, []byte(roundTripEntities)) {
+						t.Errorf("reassembled\n%q\nwant\n%q", got, roundTripEntities)
+					}
+					return
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("verify got %v, want an error with %q", err, tt.want)
+				}
+			})
+		}
+	}
+}
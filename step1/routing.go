@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/ishepherd/jira-to-markdown/safename"
+)
+
+// routingRule says where to write an element. The first rule that matches an element is used.
+type routingRule struct {
+	// Element, if set, is a glob pattern the element's name must match, e.g. "Issue" or "OS*"
+	Element string `json:"element,omitempty"`
+	// Attribute, if set, is an attribute the element must have
+	Attribute string `json:"attribute,omitempty"`
+	// Parent is the entity the element belongs to, e.g. "Issue". For documentation.
+	Parent string `json:"parent,omitempty"`
+	// Path is relative to the output dir. {name} is replaced by the value of the element's name attribute,
+	// {$element} by the element's name and {$id} by its id attribute (or one made from its attributes, see fallbackIds).
+	// {$groupIssue} is the issue of the ChangeGroup in the group attribute; if that ChangeGroup
+	// hasn't been seen the rule doesn't match.
+	Path string `json:"path"`
+
+	parts []templatePart
+}
+
+// templatePart is either literal text or a placeholder from routingRule.Path
+type templatePart struct {
+	literal     string
+	placeholder string
+}
+
+var (
+	placeholderRegexp *regexp.Regexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+	// defaultRoutingRules organise elements under the entity they belong to
+	defaultRoutingRules []routingRule = []routingRule{
+		// ChangeItems only say their ChangeGroup, which is looked up to put them under the Issue too
+		{Element: "ChangeGroup", Parent: "Issue", Path: "Issue/{issue}/ChangeGroup/{id}/{$element}.xml"},
+		{Element: "ChangeItem", Parent: "ChangeGroup", Path: "Issue/{$groupIssue}/ChangeGroup/{group}/{$element}/{$id}.xml"},
+		// JIRA writes ChangeGroups first, but just in case
+		{Element: "ChangeItem", Parent: "ChangeGroup", Path: "ChangeGroup/{group}/{$element}/{$id}.xml"},
+
+		// the actual tickets
+		{Element: "Issue", Path: "Issue/{id}/{projectKey}-{number}.xml"},
+		// all (that we want) that joins directly to an Issue
+		// Action (comment), FileAttachment (attachment metadata), etc
+		{Attribute: "issue", Parent: "Issue", Path: "Issue/{issue}/{$element}/{$id}.xml"},
+		{Attribute: "issue_id", Parent: "Issue", Path: "Issue/{issue_id}/{$element}/{$id}.xml"},
+		{Element: "IssueView", Parent: "Issue", Path: "Issue/{id}/{$element}/{$id}.xml"},
+		{Attribute: "issueId", Parent: "Issue", Path: "Issue/{issueId}/{$element}/{$id}.xml"},
+		{Attribute: "issueid", Parent: "Issue", Path: "Issue/{issueid}/{$element}/{$id}.xml"},
+
+		// User - ApplicationUser
+		// for some users the ids match eg 14143, 14149
+		// for latest user the ApplicationUser just has a guid - same in both userKey and lowerUserName
+
+		{Element: "Project", Path: "Project/{id}/{key}.xml"},
+		{Attribute: "projectId", Parent: "Project", Path: "Project/{projectId}/{$element}/{$id}.xml"},
+
+		{Element: "IssueLinkType", Path: "IssueLinkType/{id}/{linkname}.xml"},
+		{Attribute: "linktype", Parent: "IssueLinkType", Path: "IssueLinkType/{linktype}/{$element}/{$id}.xml"},
+
+		{Element: "IssueType", Path: "IssueType/{id}/{name}.xml"},
+		{Attribute: "issueTypeId", Parent: "IssueType", Path: "IssueType/{issueTypeId}/{$element}/{$id}.xml"},
+
+		{Element: "AuditLog", Path: "AuditLog/{id}/{id}.xml"},
+		{Attribute: "logId", Parent: "AuditLog", Path: "AuditLog/{logId}/{$element}/{$id}.xml"},
+
+		{Element: "CustomField", Path: "CustomField/{id}/{name}.xml"},
+		{Attribute: "customfield", Parent: "CustomField", Path: "CustomField/{customfield}/{$element}/{$id}.xml"},
+		{Attribute: "customField", Parent: "CustomField", Path: "CustomField/{customField}/{$element}/{$id}.xml"},
+		{Attribute: "customfieldId", Parent: "CustomField", Path: "CustomField/{customfieldId}/{$element}/{$id}.xml"},
+
+		{Path: "{$element}/{$id}.xml"},
+	}
+)
+
+// loadRoutingRules reads rules from a JSON file, or gives the default rules if fileName is empty.
+func loadRoutingRules(fileName string) ([]routingRule, error) {
+	rules := defaultRoutingRules
+	if fileName != "" {
+		b, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		rules = nil
+		err = json.Unmarshal(b, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", fileName, err)
+		}
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%v: rule %v: %w", fileName, i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+func printRoutingRules(w io.Writer, rules []routingRule) error {
+	b, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func (r *routingRule) compile() error {
+	if r.Path == "" {
+		return fmt.Errorf("no path")
+	}
+	if _, err := path.Match(r.Element, ""); err != nil {
+		return fmt.Errorf("element %q: %w", r.Element, err)
+	}
+	r.parts = nil
+	literalStart := 0
+	for _, m := range placeholderRegexp.FindAllStringSubmatchIndex(r.Path, -1) {
+		placeholder := r.Path[m[2]:m[3]]
+		if placeholder[0] == '$' && placeholder != "$element" && placeholder != "$id" && placeholder != "$groupIssue" {
+			return fmt.Errorf("unknown placeholder {%v}", placeholder)
+		}
+		r.parts = append(r.parts,
+			templatePart{literal: r.Path[literalStart:m[0]]},
+			templatePart{placeholder: placeholder})
+		literalStart = m[1]
+	}
+	r.parts = append(r.parts, templatePart{literal: r.Path[literalStart:]})
+	return nil
+}
+
+func (r *routingRule) matches(el xml.StartElement, attrs attributes) bool {
+	if r.Element != "" {
+		if ok, _ := path.Match(r.Element, el.Name.Local); !ok {
+			return false
+		}
+	}
+	return r.Attribute == "" || attrs.contains(r.Attribute)
+}
+
+// filename for the element, or false if the rule can't be used after all.
+// An attributeError means the element has no (usable) attribute the path needs.
+func (r *routingRule) filename(el xml.StartElement, attrs attributes, makeId func() string, changeGroups *changeGroupIndex) (string, bool, error) {
+	var result []byte
+	for _, p := range r.parts {
+		var (
+			value string
+			err   error
+		)
+		switch p.placeholder {
+		case "":
+			value = p.literal
+		case "$element":
+			value = safename.Encode(el.Name.Local)
+		case "$id":
+			value = makeId()
+		case "$groupIssue":
+			value, err = attrs.get("group")
+			if err == nil {
+				value, err = changeGroups.issue(value)
+				if err == nil && value == "" {
+					return "", false, nil
+				}
+			}
+		default:
+			value, err = attrs.get(p.placeholder)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		result = append(result, value...)
+	}
+	return string(result), true, nil
+}
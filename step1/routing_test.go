@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startElement parses the first element of s.
+func startElement(t *testing.T, s string) xml.StartElement {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start
+		}
+	}
+}
+
+func TestMakeFilename(t *testing.T) {
+	rules, err := loadRoutingRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newElementFilter("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		element string
+		want    string
+		wantErr error
+	}{
+		{`<Issue id="10" projectKey="RT" number="1"/>`, "Issue/10/RT-1.xml", nil},
+		{`<Issue id="11" projectKey="OTH/ER" number="2"/>`, "Issue/11/OTH%2FER-2.xml", nil},
+		{`<Action id="1" issue="10"/>`, "Issue/10/Action/1.xml", nil},
+		{`<ChangeGroup id="2" issue="10"/>`, "Issue/10/ChangeGroup/2/ChangeGroup.xml", nil},
+		{`<ChangeItem id="3" group="2"/>`, "Issue/10/ChangeGroup/2/ChangeItem/3.xml", nil},
+		{`<ChangeItem id="4" group="99"/>`, "ChangeGroup/99/ChangeItem/4.xml", nil},
+		{`<Label issue="10" label="red"/>`, "Issue/10/Label/_LABEL.xml", nil},
+		{`<CustomFieldValue id="5" issue="10" customfield="20"/>`, "Issue/10/CustomFieldValue/5.xml", nil},
+		{`<CustomFieldOption id="6" customfield="20"/>`, "CustomField/20/CustomFieldOption/6.xml", nil},
+		{`<Project id="1" key="RT"/>`, "Project/1/RT.xml", nil},
+		{`<Some.Element id="7"/>`, "Some%2EElement/7.xml", nil},
+		{`<Some:Element id="8"/>`, "Element/8.xml", nil},
+		{`<OSPropertyEntry id="4"/>`, "", nil},
+		{`<Issue id="12" number="3"/>`, "", errMissingAttribute},
+		{`<Action id="1" issue=""/>`, "", errEmptyAttribute},
+	}
+	opts := options{rules: rules, filter: filter, changeGroups: newChangeGroupIndex(false), ids: newFallbackIds()}
+	if err = opts.changeGroups.add("2", "10"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.element, func(t *testing.T) {
+			el := startElement(t, tt.element)
+			want := strings.ReplaceAll(tt.want, "_LABEL", newFallbackIds().forElement(el))
+			got, err := makeFilename(el, opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			var attrErr *attributeError
+			if err != nil && !errors.As(err, &attrErr) {
+				t.Errorf("got %T, want an attributeError for the quarantine", err)
+			}
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		element string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "element glob",
+			rules:   `[{"element": "Custom*", "path": "cf/{$element}-{$id}.xml"}, {"path": "other/{$id}.xml"}]`,
+			element: `<CustomFieldValue id="4"/>`,
+			want:    "cf/CustomFieldValue-4.xml",
+		},
+		{
+			name:    "element glob doesn't match",
+			rules:   `[{"element": "Custom*", "path": "cf/{$element}-{$id}.xml"}, {"path": "other/{$id}.xml"}]`,
+			element: `<Issue id="10"/>`,
+			want:    "other/10.xml",
+		},
+		{
+			name:    "attribute",
+			rules:   `[{"attribute": "project", "path": "p/{project}/{name}.xml"}, {"path": "other/{$id}.xml"}]`,
+			element: `<Component id="3" project="1" name="Back end"/>`,
+			want:    "p/1/Back end.xml",
+		},
+		{
+			name:    "element and attribute both needed",
+			rules:   `[{"element": "Component", "attribute": "lead", "path": "lead/{lead}.xml"}, {"path": "other/{$id}.xml"}]`,
+			element: `<Component id="3" project="1"/>`,
+			want:    "other/3.xml",
+		},
+		{
+			name:    "a placeholder's value is encoded, the rest of the path isn't",
+			rules:   `[{"path": "a b/{name}.xml"}]`,
+			element: `<Version id="2" name="v1/beta"/>`,
+			want:    "a b/v1%2Fbeta.xml",
+		},
+		{
+			name:    "no rule matches",
+			rules:   `[{"element": "Issue", "path": "{$id}.xml"}]`,
+			element: `<Version id="2"/>`,
+			want:    "",
+		},
+		{
+			name:    "unknown placeholder",
+			rules:   `[{"path": "{$project}/{$id}.xml"}]`,
+			wantErr: "rule 1: unknown placeholder {$project}",
+		},
+		{
+			name:    "no path",
+			rules:   `[{"path": "{$id}.xml"}, {"element": "Issue"}]`,
+			wantErr: "rule 2: no path",
+		},
+		{
+			name:    "bad glob",
+			rules:   `[{"element": "[Issue", "path": "{$id}.xml"}]`,
+			wantErr: `rule 1: element "[Issue": syntax error in pattern`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(fileName, []byte(tt.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := loadRoutingRules(fileName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := newElementFilter("", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := options{rules: rules, filter: filter, changeGroups: newChangeGroupIndex(false), ids: newFallbackIds()}
+			got, err := makeFilename(startElement(t, tt.element), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+var (
+	// controlNames are the ASCII control characters XML 1.0 doesn't allow. Tab, LF and CR are allowed.
+	controlNames [0x20]string = [0x20]string{
+		"NUL", "SOH", "STX", "ETX", "EOT", "ENQ", "ACK", "BEL", "BS", "", "", "VT", "FF", "", "SO", "SI",
+		"DLE", "DC1", "DC2", "DC3", "DC4", "NAK", "SYN", "ETB", "CAN", "EM", "SUB", "ESC", "FS", "GS", "RS", "US",
+	}
+	// nonCharacters are also illegal, U+FFFE and U+FFFF encoded as UTF-8
+	nonCharacters map[string]string = map[string]string{
+		"\xef\xbf\xbe": "U+FFFE",
+		"\xef\xbf\xbf": "U+FFFF",
+	}
+)
+
+// replacement is an illegal character the sanitizer replaced.
+type replacement struct {
+	offset   int64  // where the replacement is in the sanitized output
+	original []byte // the illegal character
+	length   int    // of the replacement
+}
+
+// sanitizer replaces characters that aren't allowed in XML 1.0, which the decoder would otherwise stop at.
+// e.g. U+001D becomes {GS} with the default escape of {%v}, where %v is the character's name.
+//
+// Everything downstream, including the manifest's offsets, sees the sanitized input.
+// The replacements are recorded in the manifest so the original can be reassembled.
+type sanitizer struct {
+	src    io.Reader
+	escape string // %v is replaced with the character's name
+	quiet  bool   // don't log each replacement
+
+	buf      []byte
+	carry    []byte // held back because it might be the start of U+FFFE
+	pending  []byte // sanitized, not yet read
+	inPos    int64  // offset in the original input
+	outPos   int64  // offset in the sanitized output
+	line     int
+	eof      bool
+	replaced []replacement
+}
+
+func newSanitizer(src io.Reader, escape string) *sanitizer {
+	return &sanitizer{
+		src:    src,
+		escape: escape,
+		buf:    make([]byte, 64*1024),
+		line:   1,
+	}
+}
+
+func (s *sanitizer) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.eof {
+			return 0, io.EOF
+		}
+		n, err := s.src.Read(s.buf)
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		data := append(s.carry, s.buf[:n]...)
+		s.carry = nil
+		s.sanitize(data)
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *sanitizer) sanitize(data []byte) {
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		var original []byte
+		name := ""
+		switch {
+		case b < 0x20 && controlNames[b] != "":
+			original, name = data[i:i+1], controlNames[b]
+		case b == 0xef:
+			if len(data)-i < 3 && !s.eof {
+				s.carry = append([]byte{}, data[i:]...)
+				return
+			}
+			if len(data)-i >= 3 {
+				if n, ok := nonCharacters[string(data[i:i+3])]; ok {
+					original, name = data[i:i+3], n
+				}
+			}
+		case b == '\n':
+			s.line++
+		}
+
+		if original == nil {
+			s.pending = append(s.pending, b)
+			s.inPos++
+			s.outPos++
+			continue
+		}
+		with := strings.ReplaceAll(s.escape, "%v", name)
+		if !s.quiet {
+			log.Printf("line %v, offset %v: replaced illegal character %v with %q", s.line, s.inPos, name, with)
+		}
+		s.replaced = append(s.replaced, replacement{
+			offset:   s.outPos,
+			original: bytes.Clone(original),
+			length:   len(with),
+		})
+		s.pending = append(s.pending, with...)
+		s.inPos += int64(len(original))
+		s.outPos += int64(len(with))
+		i += len(original) - 1
+	}
+}
+
+// unsanitizer writes the sanitized input back as the original, undoing the replacements.
+type unsanitizer struct {
+	w        io.Writer
+	replaced []replacement // in order
+	pos      int64         // offset in the sanitized input
+	skip     int           // remaining bytes of a replacement to drop
+	written  int64         // size of the original so far
+}
+
+func (u *unsanitizer) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if u.skip > 0 {
+			n := min(u.skip, len(p))
+			u.skip -= n
+			u.pos += int64(n)
+			p = p[n:]
+			continue
+		}
+		n := len(p)
+		if len(u.replaced) > 0 {
+			n = int(min(int64(n), u.replaced[0].offset-u.pos))
+		}
+		if n == 0 {
+			// at a replacement, put the original back
+			r := u.replaced[0]
+			u.replaced = u.replaced[1:]
+			if _, err := u.w.Write(r.original); err != nil {
+				return 0, err
+			}
+			u.written += int64(len(r.original))
+			u.skip = r.length
+			continue
+		}
+		if _, err := u.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+		u.pos += int64(n)
+		u.written += int64(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// finish writes any replacements at the very end, which were replaced with nothing.
+func (u *unsanitizer) finish() error {
+	for _, r := range u.replaced {
+		if r.offset != u.pos || r.length != 0 {
+			return fmt.Errorf("replaced %x at %v is beyond the end of the input at %v", r.original, r.offset, u.pos)
+		}
+		if _, err := u.w.Write(r.original); err != nil {
+			return err
+		}
+		u.written += int64(len(r.original))
+	}
+	u.replaced = nil
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestSanitizeRoundTrip checks the unsanitizer puts back exactly what the sanitizer replaced,
+// however the input is split into reads and the output into writes.
+func TestSanitizeRoundTrip(t *testing.T) {
+	inputs := map[string]string{
+		"nothing to replace":   "<a b=\"c\">text</a>\n",
+		"GS":                   "<a>one\x1dtwo</a>",
+		"several":              "\x00<a>\x1d\x1d\x1f</a>\x0b",
+		"U+FFFE and U+FFFF":    "<a>\xef\xbf\xbe and \xef\xbf\xbf</a>",
+		"legal U+FEFF":         "\xef\xbb\xbf<a>\xef\xbf\xbd</a>",
+		"replacement at EOF":   "<a/>\x1d",
+		"U+FFFE at EOF":        "<a/>\xef\xbf\xbe",
+		"partial 0xef at EOF":  "<a/>\xef\xbf",
+		"only illegal":         "\x1d",
+		"tab, LF and CR stay":  "<a>\t\r\n</a>",
+		"multibyte characters": "<a>héllo ☃ \x1d</a>",
+	}
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for _, escape := range []string{"{%v}", "", "%v%v"} {
+		for name, input := range inputs {
+			for readerName, reader := range readers {
+				t.Run(name+"/"+readerName+"/"+escape, func(t *testing.T) {
+					s := newSanitizer(reader(strings.NewReader(input)), escape)
+					s.quiet = true
+					sanitized, err := io.ReadAll(s)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, c := range sanitized {
+						if c < 0x20 && controlNames[c] != "" {
+							t.Errorf("%q still has %v", sanitized, controlNames[c])
+						}
+					}
+					for illegal := range nonCharacters {
+						if bytes.Contains(sanitized, []byte(illegal)) {
+							t.Errorf("%q still has %q", sanitized, illegal)
+						}
+					}
+					if s.inPos != int64(len(input)) || s.outPos != int64(len(sanitized)) {
+						t.Errorf("counted %v in and %v out, want %v and %v", s.inPos, s.outPos, len(input), len(sanitized))
+					}
+
+					for _, chunk := range []int{1, 2, 3, len(sanitized) + 1} {
+						var got bytes.Buffer
+						u := &unsanitizer{w: &got, replaced: append([]replacement{}, s.replaced...)}
+						for rest := sanitized; len(rest) > 0; {
+							n := min(chunk, len(rest))
+							if _, err := u.Write(rest[:n]); err != nil {
+								t.Fatal(err)
+							}
+							rest = rest[n:]
+						}
+						if err := u.finish(); err != nil {
+							t.Fatal(err)
+						}
+						if got.String() != input || u.written != int64(len(input)) {
+							t.Errorf("writing %v bytes at a time, got %q (%v bytes), want %q", chunk, got.String(), u.written, input)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSanitizeEscape(t *testing.T) {
+	s := newSanitizer(strings.NewReader("a\x1db\xef\xbf\xbec"), "{%v}")
+	s.quiet = true
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a{GS}b{U+FFFE}c"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ishepherd/jira-to-markdown/archive"
+)
+
+// sink is where the output files are written, named relative to the output e.g. Issue/13541/MYPROJ-1.xml
+type sink interface {
+	write(name string, content []byte) error
+	// flush waits until everything written so far is stored
+	flush() error
+	close() error
+}
+
+// openSink creates the output: a directory, or a .tar, .tar.gz or .zip to write the same files into.
+// Millions of small files are slow to create, an archive is one big file.
+func openSink(output string, writers int) (sink, error) {
+	format := archive.FormatOf(output)
+	if format == archive.Dir {
+		return newWriterPool(output, writers), nil
+	}
+	err := ensureDirExists(output)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 1024*1024)
+	switch format {
+	case archive.Tar:
+		return &tarSink{f: f, buf: buf, tw: tar.NewWriter(buf), modTime: time.Now()}, nil
+	case archive.TarGz:
+		gz := gzip.NewWriter(buf)
+		return &tarSink{f: f, buf: buf, gz: gz, tw: tar.NewWriter(gz), modTime: time.Now()}, nil
+	case archive.Zip:
+		return &zipSink{f: f, buf: buf, zw: zip.NewWriter(buf), names: make(map[string]bool), modTime: time.Now()}, nil
+	}
+	panic(fmt.Sprintf("unknown output format %v", format))
+}
+
+// tarSink writes the files into a tar, gzipped if gz is set.
+type tarSink struct {
+	f       *os.File
+	buf     *bufio.Writer
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func (s *tarSink) write(name string, content []byte) error {
+	err := s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(content)),
+		Mode:     0644,
+		ModTime:  s.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.tw.Write(content)
+	return err
+}
+
+func (s *tarSink) flush() error {
+	err := s.tw.Flush()
+	if err == nil && s.gz != nil {
+		err = s.gz.Flush()
+	}
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	return err
+}
+
+func (s *tarSink) close() error {
+	err := s.tw.Close()
+	if err == nil && s.gz != nil {
+		err = s.gz.Close()
+	}
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// zipSink writes the files into a zip.
+type zipSink struct {
+	f       *os.File
+	buf     *bufio.Writer
+	zw      *zip.Writer
+	names   map[string]bool
+	modTime time.Time
+}
+
+func (s *zipSink) write(name string, content []byte) error {
+	if s.names[name] {
+		// a zip with the same name twice can't be read through io/fs
+		log.Printf("%v was written again, the zip keeps the first", name)
+		return nil
+	}
+	s.names[name] = true
+	w, err := s.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: s.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (s *zipSink) flush() error {
+	err := s.zw.Flush()
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	return err
+}
+
+func (s *zipSink) close() error {
+	err := s.zw.Close()
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ishepherd/jira-to-markdown/archive"
+)
+
+// TestSinkRoundTrip checks the files written through each sink read back the same through archive.Open.
+func TestSinkRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"Issue/10/RT-1.xml":                         "<Issue id=\"10\"/>\n",
+		"Issue/10/Action/1.xml":                     "<Action id=\"1\"/>\n",
+		"Issue/10/AO_60DB71_ISSUERANKING/_3fa9.xml": "",
+		"Issue/11/OTH%2FER-2.xml":                   "<Issue id=\"11\"/>\n",
+		"IssueType/1/Bug fix.xml":                   "<IssueType id=\"1\" name=\"Bug fix\"/>\n",
+		"_quarantine/report.tsv":                    "offset\telement\tfile\tproblem\n",
+	}
+	for _, output := range []string{"out", "out.tar", "out.tar.gz", "out.zip"} {
+		t.Run(output, func(t *testing.T) {
+			output = filepath.Join(t.TempDir(), output)
+			s, err := openSink(output, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range files {
+				if err = s.write(name, []byte(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = s.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			fsys, closer, err := archive.Open(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closer.Close()
+			got := make(map[string]string)
+			err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				b, err := fs.ReadFile(fsys, name)
+				got[name] = string(b)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, files) {
+				t.Errorf("read back %q\nwant %q", got, files)
+			}
+			if err = fstest.TestFS(fsys, "Issue/10/RT-1.xml", "Issue/11/OTH%2FER-2.xml", "_quarantine/report.tsv"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
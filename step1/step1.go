@@ -2,17 +2,21 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"crypto/sha256"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"time"
 
+	"github.com/ishepherd/jira-to-markdown/archive"
+	"github.com/ishepherd/jira-to-markdown/safename"
 	cli "github.com/jawher/mow.cli"
 )
 
@@ -20,18 +24,65 @@ func main() {
 	app := cli.App(flag.CommandLine.Name(), `step 1 - Split entities.xml
 
 Most elements in the XML file will be copied into dedicated output files.
-Ignored elements and other content will be written to `+remainderFile+` in the current directory.`)
-	app.Spec = "[-o] FILE"
+Ignored elements and other content will be written to `+remainderFile+` in the current directory.
+The rows of activeobjects.xml (from the zip, or next to entities.xml) are written out too.`)
+	app.Spec = "[-o] [--rules] [--boring] [--include...] [--exclude...] [--project...] [--created-after] [--updated-after] [--escape] [--resume] [--writers] ([--verify] FILE | --print-rules | --reassemble)"
 	var (
-		outputDir = app.StringOpt("o outputDir", "/Volumes/ramdisk/_tmp", "where to create output files")
-		fileName  = app.StringArg("FILE", "", "entities.xml file location")
+		outputDir    = app.StringOpt("o outputDir", "/Volumes/ramdisk/_tmp", "where to create output files: a dir, or a .tar, .tar.gz or .zip to write them into")
+		rulesFile    = app.StringOpt("rules", "", "JSON file of rules for where to write each element, instead of the built-in ones")
+		boringFile   = app.StringOpt("boring", "", "JSON file with a list of boring element names (glob patterns), instead of the built-in list")
+		include      = app.StringsOpt("include", nil, "write elements matching this glob pattern to their own file even if they are boring")
+		exclude      = app.StringsOpt("exclude", nil, "treat elements matching this glob pattern as boring")
+		projects     = app.StringsOpt("project", nil, "only keep the issues in this project, by key e.g. MYPROJ, and what belongs to them. Can be repeated")
+		createdAfter = app.StringOpt("created-after", "", "only keep the issues created on or after this date, e.g. 2020-01-31 or \"2020-01-31 13:45\"")
+		updatedAfter = app.StringOpt("updated-after", "", "only keep the issues updated on or after this date")
+		escape       = app.StringOpt("escape", "{%v}", "replace characters that aren't allowed in XML with this, %v is the character's name e.g. GS")
+		writers      = app.IntOpt("writers", runtime.NumCPU(), "how many files to write at once")
+		resume       = app.BoolOpt("resume", false, "continue an interrupted run from its last checkpoint")
+		printRules   = app.BoolOpt("print-rules", false, "print the rules for where to write each element, and exit")
+		verifyOnly   = app.BoolOpt("verify", false, "instead of splitting FILE, check a previous run accounted for every byte of it")
+		reassembly   = app.StringOpt("reassemble", "", "put the output of a previous run back together into this file, which should be identical to the original entities.xml")
+		fileName     = app.StringArg("FILE", "", "entities.xml file location, or the backup .zip containing it")
 	)
 	app.Action = func() {
-		if err := run(*fileName, *outputDir); err != nil {
+		rules, err := loadRoutingRules(*rulesFile)
+		if err != nil {
 			log.Println(err)
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				log.Printf("command output was: %v\n", exiterr.Stderr)
+			cli.Exit(1)
+		}
+		if *printRules {
+			if err = printRoutingRules(os.Stdout, rules); err != nil {
+				log.Println(err)
+				cli.Exit(1)
+			}
+			return
+		}
+		if *reassembly != "" {
+			if err = reassemble(*outputDir, *reassembly); err != nil {
+				log.Println(err)
+				cli.Exit(1)
+			}
+			return
+		}
+		if *verifyOnly {
+			if err = verify(*fileName, *outputDir); err != nil {
+				log.Println(err)
+				cli.Exit(1)
 			}
+			return
+		}
+		filter, err := newElementFilter(*boringFile, *include, *exclude)
+		if err != nil {
+			log.Println(err)
+			cli.Exit(1)
+		}
+		issues, err := newIssueFilter(*projects, *createdAfter, *updatedAfter)
+		if err != nil {
+			log.Println(err)
+			cli.Exit(1)
+		}
+		if err := run(*fileName, *outputDir, options{rules: rules, filter: filter, issues: issues, escape: *escape, resume: *resume, writers: *writers}); err != nil {
+			log.Println(err)
 			cli.Exit(1)
 		}
 	}
@@ -46,27 +97,135 @@ const (
 	remainderFile string = "_tmp/remainder.xml"
 )
 
-func run(fileName string, outputDir string) error {
+type options struct {
+	rules   []routingRule
+	filter  *elementFilter
+	issues  *issueFilter // nil to keep every issue
+	escape  string       // for illegal characters, see sanitizer
+	resume  bool
+	writers int
+
+	changeGroups *changeGroupIndex // built as we go
+	ids          *fallbackIds
+	quarantined  *quarantine
+}
+
+func run(fileName string, outputDir string, opts options) error {
 	// remainderFile is where we will write all the portions of the file we're NOT using
 	// so we can peek through later for anything interesting.
 	err := ensureDirExists(remainderFile)
 	if err != nil {
 		return err
 	}
-	rem, err := os.Create(remainderFile)
-	if err != nil {
-		return err
+	var (
+		cp       *checkpoint
+		rem, man *os.File
+	)
+	opts.changeGroups = newChangeGroupIndex(opts.resume)
+	opts.ids = newFallbackIds()
+	opts.quarantined = newQuarantine()
+	if opts.resume {
+		if archive.FormatOf(outputDir) != archive.Dir {
+			return fmt.Errorf("can only resume writing to a dir, not %v", outputDir)
+		}
+		cp, err = readCheckpoint(fileName, opts.issues.String())
+		if err != nil {
+			return err
+		}
+		err = opts.ids.keep(true, cp.FallbackIdsLength)
+		if err != nil {
+			return err
+		}
+		defer opts.ids.close()
+		if cp.ChangeGroups != nil {
+			opts.changeGroups.others = cp.ChangeGroups
+		}
+		opts.quarantined.restore(cp.Quarantined)
+		rem, err = openToResume(remainderFile, cp.RemainderLength)
+		if err != nil {
+			return err
+		}
+		defer rem.Close()
+		man, err = openToResume(manifestFile, cp.ManifestLength)
+		if err != nil {
+			return err
+		}
+		defer man.Close()
+	} else {
+		err = opts.ids.keep(false, 0)
+		if err != nil {
+			return err
+		}
+		defer opts.ids.close()
+		rem, err = os.Create(remainderFile)
+		if err != nil {
+			return err
+		}
+		defer rem.Close()
+		man, err = os.Create(manifestFile)
+		if err != nil {
+			return err
+		}
+		defer man.Close()
 	}
-	defer rem.Close()
-	remainder := bufio.NewWriterSize(rem, 128*1024)
-
-	err = turnRecordsIntoFiles(fileName, outputDir, remainder)
-	remainder.Flush()
+	if opts.writers < 1 {
+		return fmt.Errorf("--writers must be at least 1, got %v", opts.writers)
+	}
+	if opts.issues != nil {
+		err = opts.issues.scan(fileName, opts.escape)
+		if err != nil {
+			return err
+		}
+	}
+	files, err := openSink(outputDir, opts.writers)
 	if err != nil {
 		return err
 	}
+	out := splitOutput{
+		sink:      files,
+		remainder: bufio.NewWriterSize(rem, 128*1024),
+		manifest:  bufio.NewWriterSize(man, 128*1024),
+	}
+	if cp != nil {
+		out.remainderPos = cp.RemainderLength
+		out.manifestPos = cp.ManifestLength
+	} else {
+		err = out.start(opts.escape)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = finishFileHierarchy(outputDir)
+	err = turnRecordsIntoFiles(fileName, opts, &out, cp)
+	if err == nil && opts.changeGroups.missed > 0 {
+		log.Printf("%v ChangeItems came before their ChangeGroup or it is missing, they are in ChangeGroup/ instead of under the issue and won't appear in step2's history", opts.changeGroups.missed)
+	}
+	if err == nil {
+		err = turnActiveObjectsIntoFiles(fileName, &out, opts)
+	}
+	if ferr := out.flush(); err == nil {
+		err = ferr
+	}
+	if err == nil {
+		// Finished, there is nothing to resume
+		err = os.Remove(checkpointFile)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = opts.changeGroups.close()
+	}
+	if err == nil {
+		err = opts.ids.finish()
+	}
+	if err == nil && opts.issues != nil {
+		opts.issues.logSkipped()
+	}
+	// Close the sink either way, so an archive is readable
+	if cerr := files.close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return err
 	}
@@ -74,27 +233,28 @@ func run(fileName string, outputDir string) error {
 	return nil
 }
 
-func turnRecordsIntoFiles(fileName string, outputDir string, remainder *bufio.Writer) error {
-	fs, err := os.Stat(fileName)
+// turnRecordsIntoFiles splits the input into files and the remainder.
+// If resuming, the elements before the checkpoint are skipped as they were already written.
+func turnRecordsIntoFiles(fileName string, opts options, out *splitOutput, resumeFrom *checkpoint) error {
+	f, err := openEntities(fileName)
 	if err != nil {
 		return err
 	}
-	f, err := os.Open(fileName)
+	defer f.Close()
+	size, err := entitiesSize(fileName)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
+	// The decoder reads through r, which remembers what was read
+	// so we can copy out each element's exact bytes without seeking.
+	// Everything read is hashed too, so --reassemble can check it gets the same.
+	// Characters the decoder would stop at are replaced first, so offsets are of the sanitized input.
+	hash := sha256.New()
+	s := newSanitizer(io.TeeReader(f, hash), opts.escape)
+	r := newRecorder(bufio.NewReaderSize(s, 1024*1024))
 	d := xml.NewDecoder(r)
 	d.Strict = false
 
-	// TODO f2 is so we have a separate seek position that doesn't affect the bufio.Reader(f). Maybe it doesn't affect it anyway?
-	f2, err := os.Open(fileName)
-	if err != nil {
-		return err
-	}
-	defer f2.Close()
-
 enterRootElement:
 	for {
 		t, err := d.Token()
@@ -113,33 +273,70 @@ enterRootElement:
 	// The prologue we skipped includes XML comments that might be interesting
 	// put them in the remainder
 	endPrologue := d.InputOffset()
-	prologue, err := readByteRange(f2, 0, endPrologue)
+	prologue, err := r.take(0, endPrologue)
 	if err != nil {
 		return err
 	}
-	_, err = remainder.Write(prologue)
+	// When resuming, the decoder carries on from the checkpoint as if the elements before it weren't there,
+	// so its offsets are behind by gap.
+	var gap int64
+	if resumeFrom == nil {
+		err = out.toRemainder(0, prologue)
+	} else {
+		err = r.skipTo(resumeFrom.Offset)
+		gap = resumeFrom.Offset - endPrologue
+		log.Printf("resuming from offset %v", resumeFrom.Offset)
+	}
 	if err != nil {
 		return err
 	}
+	offset := func() int64 {
+		return d.InputOffset() + gap
+	}
+
+	// Ctrl-C stops at the next element, writing a checkpoint to resume from
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	lastCheckpoint := time.Now()
 
 	// Now save each child
+	diverted := make(map[string]int) // element types we wrote to the remainder
+	defer logDiverted(diverted)
+	prog := newProgress(size, offset())
 	for {
 		var (
-			startSkipping int64 = d.InputOffset()
+			startSkipping int64 = offset()
 			startPos      int64
 			start         xml.StartElement
 			eof           bool
 		)
+		select {
+		case <-interrupted:
+			err = writeCheckpoint(fileName, startSkipping, out, opts)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("interrupted at offset %v, run again with --resume to continue", startSkipping)
+		default:
+		}
+		if time.Since(lastCheckpoint) >= checkpointInterval {
+			lastCheckpoint = time.Now()
+			err = writeCheckpoint(fileName, startSkipping, out, opts)
+			if err != nil {
+				return err
+			}
+		}
 	enterNextElement:
 		// Skip to the next child element
 		for {
-			startPos = d.InputOffset()
+			startPos = offset()
 			t, err := d.Token()
 			if err != nil {
 				if err == io.EOF {
 					// no more elements
 					eof = true
-					startPos = fs.Size()
+					startPos = r.offset()
 					break enterNextElement
 				}
 				return err
@@ -151,18 +348,31 @@ enterRootElement:
 			}
 		}
 
+		if eof {
+			// activeobjects.xml is still to do, if it fails --resume only has to redo the end
+			err = writeCheckpoint(fileName, startSkipping, out, opts)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Write what we skipped to the remainder file.
-		skipped, err := readByteRange(f2, startSkipping, startPos)
+		skipped, err := r.take(startSkipping, startPos)
 		if err != nil {
 			return err
 		}
-		_, err = remainder.Write(skipped)
+		err = out.toRemainder(startSkipping, skipped)
 		if err != nil {
 			return err
 		}
 
 		if eof {
-			return nil
+			prog.finish(r.offset())
+			err = opts.quarantined.finish(out.sink)
+			if err != nil {
+				return err
+			}
+			return out.finish(s, hash.Sum(nil))
 		}
 
 		// Skip again, to the matching end element
@@ -172,135 +382,124 @@ enterRootElement:
 		}
 
 		// Get the entire text of the element we skipped
-		endPos := d.InputOffset()
-		content, err := readByteRange(f2, startPos, endPos)
+		endPos := offset()
+		content, err := r.take(startPos, endPos)
 		if err != nil {
 			return err
 		}
+		// If it belongs to an issue we're not keeping, only note it in the manifest
+		if opts.issues != nil {
+			skip, err := opts.issues.skips(start, opts.changeGroups)
+			if err != nil {
+				return err
+			}
+			if skip {
+				err = out.skip(startPos, endPos)
+				if err != nil {
+					return err
+				}
+				prog.element(start.Name.Local, len(content), false, endPos)
+				continue
+			}
+		}
 		// If it is boring append it to the remainder file
 		// Otherwise create a new file with this element
-		filenameForElement := makeFilename(start)
+		if start.Name.Local == "ChangeGroup" {
+			err = indexChangeGroup(start, opts.changeGroups)
+			if err != nil {
+				return err
+			}
+		}
+		filenameForElement, err := makeFilename(start, opts)
+		var attrErr *attributeError
+		if errors.As(err, &attrErr) {
+			filenameForElement = opts.quarantined.add(startPos, start, attrErr)
+		} else if err != nil {
+			return err
+		}
 		if filenameForElement == "" {
-			_, err = remainder.Write(content)
+			diverted[start.Name.Local]++
+			err = out.toRemainder(startPos, content)
 			if err != nil {
 				return err
 			}
 		} else {
 			// Copy the element into a new file
-			err = writeFile(fmt.Sprintf("%v/%v", outputDir, filenameForElement), content)
+			err = out.toFile(startPos, filenameForElement, content)
 			if err != nil {
 				return err
 			}
 		}
+		prog.element(start.Name.Local, len(content), filenameForElement != "", endPos)
 	}
 }
 
-var (
-	i int
-)
+// writeCheckpoint notes that everything before offset has been written out.
+func writeCheckpoint(fileName string, offset int64, out *splitOutput, opts options) error {
+	err := out.flush()
+	if err != nil {
+		return err
+	}
+	err = opts.changeGroups.save()
+	if err != nil {
+		return err
+	}
+	err = opts.ids.flush()
+	if err != nil {
+		return err
+	}
+	cp := checkpoint{
+		Input:             fileName,
+		Filter:            opts.issues.String(),
+		Offset:            offset,
+		RemainderLength:   out.remainderPos,
+		ManifestLength:    out.manifestPos,
+		FallbackIdsLength: opts.ids.length,
+		ChangeGroups:      opts.changeGroups.others,
+		Quarantined:       opts.quarantined.rows,
+	}
+	return cp.write()
+}
 
-func makeFilename(el xml.StartElement) string {
-	_, isBoring := boringElements[el.Name.Local]
-	if isBoring {
-		return ""
+// makeFilename says where to write the element, or "" for the remainder.
+func makeFilename(el xml.StartElement, opts options) (string, error) {
+	if opts.filter.isBoring(el.Name.Local) {
+		return "", nil
 	}
 	attrs := makeAttributes(el)
 
 	makeId := func() string {
-		if attrs.contains("id") {
-			return attrs.get("id")
-		}
-		// fallback
-		id := fmt.Sprintf("_%v", i)
-		i++
-		return id
-	}
-
-	if el.Name.Local == "ChangeGroup" {
-		// if we let these enter the next if block, it would successfully put them under the Issue
-		// however then the contained ChangeItems won't find them
-		return fmt.Sprintf("ChangeGroup/%v/issue-%v.xml",
-			attrs.get("id"), attrs.get("issue"))
-	} else if el.Name.Local == "ChangeItem" {
-		return fmt.Sprintf("ChangeGroup/%v/%v/%v.xml",
-			attrs.get("group"), el.Name.Local, makeId())
-	}
-
-	if el.Name.Local == "Issue" {
-		// the actual tickets
-		return fmt.Sprintf("Issue/%v/%v-%v.xml",
-			attrs.get("id"), attrs.get("projectKey"), attrs.get("number"))
-		// below cases: all (that we want) that joins directly to an Issue
-		// Put it under the Issue's directory
-		// Action (comment), FileAttachment (attachment metadata), etc
-	} else if attrs.contains("issue") {
-		return fmt.Sprintf("Issue/%v/%v/%v.xml",
-			attrs.get("issue"), el.Name.Local, makeId())
-	} else if attrs.contains("issue_id") {
-		return fmt.Sprintf("Issue/%v/%v/%v.xml",
-			attrs.get("issue_id"), el.Name.Local, makeId())
-	} else if el.Name.Local == "IssueView" {
-		return fmt.Sprintf("Issue/%v/%v/%v.xml",
-			attrs.get("id"), el.Name.Local, makeId())
-	} else if attrs.contains("issueId") {
-		return fmt.Sprintf("Issue/%v/%v/%v.xml",
-			attrs.get("issueId"), el.Name.Local, makeId())
-	} else if attrs.contains("issueid") {
-		return fmt.Sprintf("Issue/%v/%v/%v.xml",
-			attrs.get("issueid"), el.Name.Local, makeId())
-	}
-
-	// User - ApplicationUser
-	// for some users the ids match eg 14143, 14149
-	// for latest user the ApplicationUser just has a guid - same in both userKey and lowerUserName
-
-	if el.Name.Local == "Project" {
-		return fmt.Sprintf("Project/%v/%v.xml",
-			attrs.get("id"), attrs.get("key"))
-	} else if attrs.contains("projectId") {
-		return fmt.Sprintf("Project/%v/%v/%v.xml",
-			attrs.get("projectId"), el.Name.Local, makeId())
-	}
-
-	if el.Name.Local == "IssueLinkType" {
-		return fmt.Sprintf("IssueLinkType/%v/%v.xml",
-			attrs.get("id"), attrs.get("linkname"))
-	} else if attrs.contains("linktype") {
-		return fmt.Sprintf("IssueLinkType/%v/%v/%v.xml",
-			attrs.get("linktype"), el.Name.Local, makeId())
-	}
-
-	if el.Name.Local == "IssueType" {
-		return fmt.Sprintf("IssueType/%v/%v.xml",
-			attrs.get("id"), attrs.get("name"))
-	} else if attrs.contains("issueTypeId") {
-		return fmt.Sprintf("IssueType/%v/%v/%v.xml",
-			attrs.get("issueTypeId"), el.Name.Local, makeId())
-	}
-
-	if el.Name.Local == "AuditLog" {
-		return fmt.Sprintf("AuditLog/%v/%v.xml",
-			attrs.get("id"), attrs.get("id"))
-	} else if attrs.contains("logId") {
-		return fmt.Sprintf("AuditLog/%v/%v/%v.xml",
-			attrs.get("logId"), el.Name.Local, makeId())
-	}
-
-	if el.Name.Local == "CustomField" {
-		return fmt.Sprintf("CustomField/%v/%v.xml",
-			attrs.get("id"), attrs.get("name"))
-	} else if attrs.contains("customfield") {
-		return fmt.Sprintf("CustomField/%v/%v/%v.xml",
-			attrs.get("customfield"), el.Name.Local, makeId())
-	} else if attrs.contains("customField") {
-		return fmt.Sprintf("CustomField/%v/%v/%v.xml",
-			attrs.get("customField"), el.Name.Local, makeId())
-	} else if attrs.contains("customfieldId") {
-		return fmt.Sprintf("CustomField/%v/%v/%v.xml",
-			attrs.get("customfieldId"), el.Name.Local, makeId())
-	}
-
-	return fmt.Sprintf("%v/%v.xml", el.Name.Local, makeId())
+		if id, err := attrs.get("id"); err == nil {
+			return id
+		}
+		return opts.ids.forElement(el)
+	}
+
+	for _, rule := range opts.rules {
+		if rule.matches(el, attrs) {
+			name, ok, err := rule.filename(el, attrs, makeId, opts.changeGroups)
+			if err != nil || ok {
+				return name, err
+			}
+		}
+	}
+	// no rule for it, treat it as boring
+	return "", nil
+}
+
+// indexChangeGroup remembers a ChangeGroup's issue, for its ChangeItems.
+func indexChangeGroup(el xml.StartElement, changeGroups *changeGroupIndex) error {
+	attrs := makeAttributes(el)
+	id, err := attrs.get("id")
+	if err != nil {
+		// it will be quarantined, and its ChangeItems won't find it
+		return nil
+	}
+	issue, err := attrs.get("issue")
+	if err != nil {
+		return nil
+	}
+	return changeGroups.add(id, issue)
 }
 
 type attributes struct {
@@ -316,19 +515,41 @@ func makeAttributes(el xml.StartElement) attributes {
 }
 
 var (
-	// fileSafeRegexp matches values we accept as paths/names in the filesystem.
-	fileSafeRegexp *regexp.Regexp = regexp.MustCompile(`^[\w \[\]()\-&!]+$`)
+	errMissingAttribute = errors.New("missing attribute")
+	errEmptyAttribute   = errors.New("empty attribute")
 )
 
-func (a attributes) get(key string) string {
+// attributeError is when an element doesn't have an attribute we need for its filename.
+type attributeError struct {
+	Element   string
+	Attribute string
+	Err       error // errMissingAttribute or errEmptyAttribute
+}
+
+func (e *attributeError) Error() string {
+	return fmt.Sprintf("%v: %v %v", e.Element, e.Err, e.Attribute)
+}
+
+func (e *attributeError) Unwrap() error {
+	return e.Err
+}
+
+// get an attribute's value for use in a filename, see safename.Encode.
+func (a attributes) get(key string) (string, error) {
+	value, err := a.value(key)
+	return safename.Encode(value), err
+}
+
+// value of an attribute as it is.
+func (a attributes) value(key string) (string, error) {
 	result, ok := a.theAttribs[key]
 	if !ok {
-		panic(fmt.Sprintf("oops I thought the %v had a %v attribute. %v", a.element.Name, key, a))
+		return "", &attributeError{Element: a.element.Name.Local, Attribute: key, Err: errMissingAttribute}
 	}
-	if !fileSafeRegexp.MatchString(result.Value) {
-		panic(fmt.Sprintf("oops I thought every %v would be safe for the filesystem. %s", result.Value, a))
+	if result.Value == "" {
+		return "", &attributeError{Element: a.element.Name.Local, Attribute: key, Err: errEmptyAttribute}
 	}
-	return result.Value
+	return result.Value, nil
 }
 
 func (a attributes) contains(key string) bool {
@@ -344,18 +565,6 @@ func makeMap[K comparable, V any](src []V, key func(V) K) map[K]V {
 	return result
 }
 
-func writeFile(name string, content []byte) error {
-	err := ensureDirExists(name)
-	if err != nil {
-		return err
-	}
-	err = os.WriteFile(name, content, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 func ensureDirExists(name string) error {
 	dir := filepath.Dir(name)
 	_, err := os.Stat(dir)
@@ -466,79 +675,3 @@ var (
 		"OSWorkflowEntry":   {},
 	}
 )
-
-func readByteRange(f *os.File, startPos int64, endPos int64) ([]byte, error) {
-	newOffset, err := f.Seek(startPos, 0)
-	if err != nil {
-		return nil, err
-	}
-	if newOffset != startPos {
-		panic(fmt.Sprintf("seek: wanted %v got %v", startPos, newOffset))
-	}
-	childContent := make([]byte, endPos-startPos)
-	n, err := f.Read(childContent)
-	if err != nil {
-		return nil, err
-	}
-	if n != len(childContent) {
-		panic(fmt.Sprintf("read: wanted %v got %v", len(childContent), n))
-	}
-	return childContent, nil
-}
-
-var (
-	issueNumRegex *regexp.Regexp = regexp.MustCompile(`(.*ChangeGroup)/([^/]+)/issue-([0-9]+)\.xml$`)
-)
-
-func finishFileHierarchy(tmpDir string) error {
-	// So far we left ChangeGroup at root (because ChangeItems needed to find their ChangeGroup).
-	// Fix this now
-	// e.g. ChangeGroup/123
-	//        if it contains a issue-4.xml
-	//        move it to Issue/4/ChangeGroup/123
-	changeGroupRoot := fmt.Sprintf("%v/ChangeGroup", tmpDir)
-	cmd := exec.Command("find", changeGroupRoot, "-name", "issue-*.xml", "-type", "f", "-maxdepth", "2")
-	files, err := cmd.Output()
-	if err != nil {
-		return err
-	}
-
-	scanner := bufio.NewScanner(bytes.NewReader(files))
-	for scanner.Scan() {
-		file := scanner.Text()
-
-		changeGroup := issueNumRegex.FindStringSubmatch(file)
-		if changeGroup == nil {
-			panic(fmt.Sprintf("wanted a issue-*.xml file: %v", file))
-		}
-		dir := changeGroup[1]
-		changeGroupNum := changeGroup[2]
-		issueNum := changeGroup[3]
-
-		renameFrom := fmt.Sprintf("%v/%v", dir, changeGroupNum)
-		issueDir := fmt.Sprintf("%v/Issue/%v", tmpDir, issueNum)
-		renameTo := fmt.Sprintf("%v/ChangeGroup/%v", issueDir, changeGroupNum)
-
-		_, err = os.Stat(issueDir)
-		if err != nil {
-			return fmt.Errorf("The ChangeGroup %s wants this issue dir %s but we saw nothing else for that issue: %w", file, issueDir, err)
-		}
-
-		err = ensureDirExists(renameTo)
-		if err != nil {
-			return err
-		}
-
-		err = os.Rename(renameFrom, renameTo)
-		if err != nil {
-			return err
-		}
-	}
-
-	if scanner.Err() != nil {
-		return scanner.Err()
-	}
-
-	err = os.Remove(changeGroupRoot) // if empty
-	return err
-}
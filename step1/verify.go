@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ishepherd/jira-to-markdown/archive"
+)
+
+const (
+	// maxReported problems of each kind, after that they're only counted
+	maxReported int = 20
+)
+
+// verifier reconciles the input with what step1 wrote, using the manifest.
+type verifier struct {
+	output    fs.FS
+	remainder *os.File
+
+	problems map[string]int // counts by kind
+}
+
+func (v *verifier) report(kind string, format string, args ...any) {
+	v.problems[kind]++
+	if v.problems[kind] <= maxReported {
+		log.Printf("%v: %v", kind, fmt.Sprintf(format, args...))
+	}
+}
+
+// verify checks every byte of the input is in exactly one place in the output,
+// i.e. that the remainder and output files could be put back together into the input.
+func verify(fileName string, outputDir string) error {
+	entries, summary, err := readManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	rem, err := os.Open(remainderFile)
+	if err != nil {
+		return err
+	}
+	defer rem.Close()
+	output, closer, err := archive.Open(outputDir)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	v := verifier{
+		output:    output,
+		remainder: rem,
+		problems:  make(map[string]int),
+	}
+
+	// Files written more than once keep only the last content, except in a zip, see zipSink
+	kept := "last"
+	if archive.FormatOf(outputDir) == archive.Zip {
+		kept = "first"
+	}
+	writes := make(map[string]int)
+	for _, e := range entries {
+		if e.file == remainderDest || e.file == skippedDest {
+			continue
+		}
+		writes[e.file]++
+	}
+	for file, n := range writes {
+		if n > 1 {
+			v.report("overwritten", "%v was written %v times, only the %v is kept", file, n, kept)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].start < entries[j].start
+	})
+
+	f, err := openEntities(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if summary.sanitized {
+		// The manifest is of the input after replacing illegal characters, do the same
+		s := newSanitizer(f, summary.escape)
+		s.quiet = true
+		in = s
+	}
+	input := bufio.NewReaderSize(in, 1024*1024)
+	var (
+		pos          int64 // how far through the input we are
+		manifestSize int64
+		skippedSize  int64
+		outputFiles  = make(map[string]bool)
+	)
+	for _, e := range entries {
+		manifestSize += e.end - e.start
+		if e.file != remainderDest && e.file != skippedDest {
+			outputFiles[e.file] = true
+		}
+		if e.start > pos {
+			v.report("lost", "input bytes %v-%v were not written anywhere", pos, e.start)
+			if _, err = io.CopyN(io.Discard, input, e.start-pos); err != nil {
+				return fmt.Errorf("input ends at %v, before the manifest: %w", pos, err)
+			}
+			pos = e.start
+		}
+		from := e.start
+		if e.end <= pos {
+			v.report("duplicated", "input bytes %v-%v were written again to %v", e.start, e.end, e.file)
+			continue
+		}
+		if from < pos {
+			v.report("duplicated", "input bytes %v-%v were written again to %v", e.start, pos, e.file)
+			from = pos
+		}
+		if e.file == skippedDest {
+			// left out by --project etc., there's nothing to compare
+			if _, err = io.CopyN(io.Discard, input, e.end-from); err != nil {
+				return fmt.Errorf("input ends before %v, the end of the manifest: %w", e.end, err)
+			}
+			pos = e.end
+			skippedSize += e.end - from
+			continue
+		}
+		want := make([]byte, e.end-from)
+		if _, err = io.ReadFull(input, want); err != nil {
+			return fmt.Errorf("input ends before %v, the end of the manifest: %w", e.end, err)
+		}
+		pos = e.end
+		err = v.compare(e, from, want)
+		if err != nil {
+			return err
+		}
+	}
+	trailing, err := io.Copy(io.Discard, input)
+	if err != nil {
+		return err
+	}
+	if trailing != 0 {
+		v.report("lost", "input bytes %v-%v, the end of the input, were not written anywhere", pos, pos+trailing)
+	}
+	inputSize := pos + trailing
+
+	// Account for the other files found in the output dir
+	var outputSize, otherSize, otherCount int64
+	err = fs.WalkDir(output, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if outputFiles[path] {
+			outputSize += info.Size()
+		} else {
+			otherSize += info.Size()
+			otherCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	remInfo, err := rem.Stat()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%-28v %v bytes", "input:", inputSize)
+	log.Printf("%-28v %v bytes", "manifest:", manifestSize)
+	log.Printf("%-28v %v bytes in %v files", "output files from the input:", outputSize, len(outputFiles))
+	log.Printf("%-28v %v bytes", "remainder:", remInfo.Size())
+	if skippedSize > 0 {
+		log.Printf("%-28v %v bytes (other issues, left out by --project etc.)", "skipped:", skippedSize)
+	}
+	log.Printf("%-28v %v bytes in %v files (e.g. from activeobjects.xml or step2)", "other files in output dir:", otherSize, otherCount)
+	if len(v.problems) == 0 {
+		if skippedSize > 0 {
+			log.Printf("OK: every byte of the input is in exactly one place, or was skipped")
+			return nil
+		}
+		log.Printf("OK: every byte of the input is in exactly one place")
+		return nil
+	}
+	kinds := make([]string, 0, len(v.problems))
+	for kind, n := range v.problems {
+		kinds = append(kinds, fmt.Sprintf("%v %v", n, kind))
+	}
+	sort.Strings(kinds)
+	return fmt.Errorf("verify failed: %v", strings.Join(kinds, ", "))
+}
+
+// compare checks the output has want, which is the input from offset from.
+func (v *verifier) compare(e manifestEntry, from int64, want []byte) error {
+	fileOffset := e.fileOffset + (from - e.start)
+	if e.file == remainderDest {
+		got := make([]byte, len(want))
+		n, err := v.remainder.ReadAt(got, fileOffset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !bytes.Equal(got[:n], want) {
+			v.report("mismatch", "input bytes %v-%v are not at %v in the remainder", from, e.end, fileOffset)
+		}
+		return nil
+	}
+
+	got, err := fs.ReadFile(v.output, e.file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			v.report("missing", "%v, from input bytes %v-%v", e.file, e.start, e.end)
+			return nil
+		}
+		return err
+	}
+	if int64(len(got)) != e.end-e.start {
+		v.report("mismatch", "%v is %v bytes but was %v bytes of input (%v-%v)", e.file, len(got), e.end-e.start, e.start, e.end)
+		return nil
+	}
+	if !bytes.Equal(got[fileOffset:], want) {
+		v.report("mismatch", "%v differs from input bytes %v-%v", e.file, e.start, e.end)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// writerPool is the sink for a directory. It writes files on several goroutines,
+// as creating millions of small files is the slow part.
+// Writes of the same file always go to the same goroutine, so they happen in the order they were made.
+type writerPool struct {
+	dir     string
+	queues  []chan fileWrite
+	running sync.WaitGroup // the goroutines
+	pending sync.WaitGroup // the writes
+	dirs    dirCache
+
+	mu  sync.Mutex
+	err error // the first error, later writes are dropped
+}
+
+type fileWrite struct {
+	name    string
+	content []byte
+}
+
+func newWriterPool(dir string, n int) *writerPool {
+	p := &writerPool{
+		dir:    dir,
+		queues: make([]chan fileWrite, n),
+		dirs:   dirCache{made: make(map[string]bool)},
+	}
+	for q := range p.queues {
+		// Bounded, so the decoder waits if it gets too far ahead
+		p.queues[q] = make(chan fileWrite, 256)
+		p.running.Add(1)
+		go p.writer(p.queues[q])
+	}
+	return p
+}
+
+func (p *writerPool) writer(queue chan fileWrite) {
+	defer p.running.Done()
+	for w := range queue {
+		if p.failed() == nil {
+			err := p.dirs.ensure(filepath.Dir(w.name))
+			if err == nil {
+				err = os.WriteFile(w.name, w.content, 0644)
+			}
+			if err != nil {
+				p.fail(err)
+			}
+		}
+		p.pending.Done()
+	}
+}
+
+// write queues a file to be written. The error is from an earlier write, if one failed.
+func (p *writerPool) write(name string, content []byte) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	p.pending.Add(1)
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- fileWrite{fmt.Sprintf("%v/%v", p.dir, name), content}
+	return nil
+}
+
+// flush waits until everything queued so far is written.
+func (p *writerPool) flush() error {
+	p.pending.Wait()
+	return p.failed()
+}
+
+// close waits for the writes and stops the goroutines.
+func (p *writerPool) close() error {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.running.Wait()
+	return p.failed()
+}
+
+func (p *writerPool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *writerPool) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// dirCache remembers which dirs exist, to save a MkdirAll for every file.
+type dirCache struct {
+	mu   sync.Mutex
+	made map[string]bool
+}
+
+func (c *dirCache) ensure(dir string) error {
+	c.mu.Lock()
+	made := c.made[dir]
+	c.mu.Unlock()
+	if made {
+		return nil
+	}
+	// Two writers might both make it, which is harmless
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.made[dir] = true
+	c.mu.Unlock()
+	return nil
+}
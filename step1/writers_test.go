@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// syntheticIssues is how many issues writeSyntheticEntities makes, each with a few elements under it.
+const syntheticIssues int = 2000
+
+// writeSyntheticEntities writes an entities.xml with issues, comments, change groups and items,
+// about 10 files per issue, in the order JIRA writes them.
+func writeSyntheticEntities(b *testing.B) string {
+	b.Helper()
+	name := filepath.Join(b.TempDir(), entitiesFile)
+	f, err := os.Create(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<entity-engine-xml>\n")
+	for i := 0; i < syntheticIssues; i++ {
+		for j := 0; j < 3; j++ {
+			fmt.Fprintf(w, "    <Action id=\"%v\" issue=\"%v\" author=\"admin\" type=\"comment\" body=\"comment %v on issue %v\" created=\"2020-01-02 10:00:00.0\"/>\n",
+				i*3+j, i, j, i)
+		}
+	}
+	for i := 0; i < syntheticIssues; i++ {
+		fmt.Fprintf(w, "    <ChangeGroup id=\"%v\" issue=\"%v\" author=\"admin\" created=\"2020-01-02 10:00:00.0\"/>\n", i, i)
+	}
+	for i := 0; i < syntheticIssues; i++ {
+		for j := 0; j < 4; j++ {
+			fmt.Fprintf(w, "    <ChangeItem id=\"%v\" group=\"%v\" fieldtype=\"jira\" field=\"status\" oldvalue=\"1\" oldstring=\"Open\" newvalue=\"3\" newstring=\"In Progress\"/>\n",
+				i*4+j, i)
+		}
+	}
+	for i := 0; i < syntheticIssues; i++ {
+		fmt.Fprintf(w, "    <Issue id=\"%v\" projectKey=\"BENCH\" number=\"%v\" project=\"10000\" reporter=\"admin\" type=\"1\" summary=\"Issue %v\" created=\"2020-01-02 10:00:00.0\"/>\n",
+			i, i+1, i)
+	}
+	fmt.Fprintf(w, "</entity-engine-xml>\n")
+	if err = w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	return name
+}
+
+// BenchmarkWriters splits a synthetic entities.xml into a dir with one writer and with several.
+// Run with: go test -run NONE -bench Writers ./step1
+func BenchmarkWriters(b *testing.B) {
+	input := writeSyntheticEntities(b)
+	// the checkpoint at the end of the input goes in _tmp
+	chdirTemp(b)
+	rules, err := loadRoutingRules("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	filter, err := newElementFilter("", nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// progress and the element table are logged, which would drown the results
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, writers := range []int{1, max(4, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("writers=%v", writers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := b.TempDir()
+				opts := options{
+					rules:        rules,
+					filter:       filter,
+					escape:       "{%v}",
+					writers:      writers,
+					changeGroups: newChangeGroupIndex(false),
+					ids:          newFallbackIds(),
+					quarantined:  newQuarantine(),
+				}
+				b.StartTimer()
+
+				files, err := openSink(dir, writers)
+				if err != nil {
+					b.Fatal(err)
+				}
+				out := splitOutput{
+					sink:      files,
+					remainder: bufio.NewWriter(io.Discard),
+					manifest:  bufio.NewWriter(io.Discard),
+				}
+				err = turnRecordsIntoFiles(input, opts, &out, nil)
+				if err == nil {
+					err = out.flush()
+				}
+				if cerr := files.close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
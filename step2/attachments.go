@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ishepherd/jira-to-markdown/safename"
+)
+
+func (t taskData) readAttachments(child fs.DirEntry, issue Issue) ([]OutputAttachment, error) {
+	children, err := fs.ReadDir(t.input, fmt.Sprintf("%v/%v", t.issueDir, child.Name()))
+	if err != nil {
+		return nil, err
+	}
+	attachments := make([]OutputAttachment, len(children))
+	for i, attachmentFile := range children {
+		af := fmt.Sprintf("%v/%v/%v", t.issueDir, child.Name(), attachmentFile.Name())
+		b, err := fs.ReadFile(t.input, af)
+		if err != nil {
+			return attachments, err
+		}
+		var attachment FileAttachment
+		err = unmarshal(b, &attachment, af)
+		if err != nil {
+			return attachments, err
+		}
+		attachments[i] = OutputAttachment{FileAttachment: attachment}
+	}
+	// Oldest first, so if names collide the first upload keeps its name
+	sort.SliceStable(attachments, func(i, j int) bool {
+		if attachments[i].Created != attachments[j].Created {
+			return attachments[i].Created < attachments[j].Created
+		}
+		return attachments[i].Id < attachments[j].Id
+	})
+
+	if t.attachmentsDir == "" {
+		return attachments, nil
+	}
+	used := make(map[string]bool)
+	for i := range attachments {
+		a := &attachments[i]
+		from, err := t.catalog.locateAttachment(t.attachmentsDir, issue, a.Id)
+		if err != nil {
+			return attachments, err
+		}
+		if from == "" {
+			a.Missing = true
+			t.catalog.missingAttachments = append(t.catalog.missingAttachments,
+				fmt.Sprintf("%v: %v (id %v)", issue.Key(), a.FileName, a.Id))
+			continue
+		}
+		a.Path = fmt.Sprintf("%v/%v", safename.Encode(issue.Key()), uniqueFileName(a.FileName, used))
+		err = copyAttachment(from, fmt.Sprintf("%v/%v", t.markdownDir, a.Path), t.linkAttachments)
+		if err != nil {
+			return attachments, err
+		}
+	}
+	return attachments, nil
+}
+
+// locateAttachment finds the attachment's file in the backup's data/attachments directory.
+// JIRA has used a few layouts over the years, the current one is
+// <project key>/<bucket of 10000 issues>/<issue key>/<attachment id>
+func (c *catalog) locateAttachment(attachmentsDir string, issue Issue, id int) (string, error) {
+	bucket := ((issue.Number-1)/10000 + 1) * 10000
+	candidates := []string{
+		fmt.Sprintf("%v/%v/%v/%v/%v", attachmentsDir, issue.ProjectKey, bucket, issue.Key(), id),
+		fmt.Sprintf("%v/%v/%v/%v/%v", attachmentsDir, issue.ProjectKey, bucket, issue.Id, id),
+		fmt.Sprintf("%v/%v/%v/%v", attachmentsDir, issue.ProjectKey, issue.Key(), id),
+	}
+	for _, candidate := range candidates {
+		if fi, err := os.Stat(candidate); err == nil && fi.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+	// The issue may have been moved from another project, which keeps its attachments where they were
+	if c.attachmentFiles == nil {
+		err := c.indexAttachments(attachmentsDir)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, m := range c.attachmentFiles[fmt.Sprint(id)] {
+		dir := filepath.Base(filepath.Dir(m))
+		if dir == issue.Key() || dir == fmt.Sprint(issue.Id) {
+			return m, nil
+		}
+	}
+	return "", nil
+}
+
+// indexAttachments lists every file in the attachments dir once, rather than searching it for each one that's missing.
+func (c *catalog) indexAttachments(attachmentsDir string) error {
+	c.attachmentFiles = make(map[string][]string)
+	return filepath.WalkDir(attachmentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			c.attachmentFiles[d.Name()] = append(c.attachmentFiles[d.Name()], path)
+		}
+		return nil
+	})
+}
+
+// uniqueFileName makes a name safe for the filesystem and different to the ones already used,
+// e.g. the second "screenshot.png" becomes "screenshot-2.png".
+func uniqueFileName(name string, used map[string]bool) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", "\x00", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	result := name
+	for n := 2; used[strings.ToLower(result)]; n++ {
+		// lower case because the filesystem might be case-insensitive
+		result = fmt.Sprintf("%v-%v%v", base, n, ext)
+	}
+	used[strings.ToLower(result)] = true
+	return result
+}
+
+// copyAttachment copies, or hardlinks if asked and possible, the attachment's file.
+func copyAttachment(from string, to string, link bool) error {
+	err := ensureDirExists(to)
+	if err != nil {
+		return err
+	}
+	// from a previous run
+	err = os.Remove(to)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if link {
+		if err = os.Link(from, to); err == nil {
+			return nil
+		}
+		// e.g. a different filesystem, fall back to copying
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%v B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
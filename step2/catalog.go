@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// catalog holds the entities shared by all issues, loaded once from step1's output.
+type catalog struct {
+	input fs.FS // step1's output
+
+	statuses    map[int]lookupEntity
+	priorities  map[int]lookupEntity
+	resolutions map[int]lookupEntity
+	issueTypes  map[int]lookupEntity
+
+	customFields       map[int]customField
+	customFieldOptions map[int]customFieldOption
+	sprints            map[int]sprint
+
+	issueKeys      map[int]string // by issue id
+	issueLinkTypes map[int]issueLinkType
+	issueLinks     map[int][]issueLink // by the id of either issue
+	hierarchy      *hierarchy
+
+	users map[string]OutputUser // by user key
+	// unknownUser is how to show a user key we can't find, e.g. the user was deleted. {key} is replaced by the key.
+	unknownUser string
+	// unresolvedUsers counts the issues that refer to each user key we couldn't find
+	unresolvedUsers map[string]int
+	// unresolvedInIssue are the keys we couldn't find in the issue being resolved, see countUnresolvedUsers
+	unresolvedInIssue map[string]bool
+	// missingAttachments are the attachments whose files we couldn't find
+	missingAttachments []string
+	// attachmentFiles are the files in the attachments dir by name, i.e. attachment id.
+	// It's only made the first time an attachment isn't where we expect, see locateAttachment.
+	attachmentFiles map[string][]string
+	// badEpicLinks are the Epic Link values that aren't an issue id
+	badEpicLinks []string
+}
+
+// lookupEntity is the part we need of a Status, Priority, Resolution or IssueType.
+type lookupEntity struct {
+	Id             int    `xml:"id,attr"`
+	Name           string `xml:"name,attr"`
+	StatusCategory int    `xml:"statuscategory,attr"`
+}
+
+var (
+	// statusCategories are built into JIRA rather than being in the backup
+	statusCategories map[int]string = map[int]string{
+		1: "No Category",
+		2: "To Do",
+		3: "Done",
+		4: "In Progress",
+	}
+)
+
+func loadCatalog(input fs.FS, unknownUser string) (*catalog, error) {
+	var (
+		c = catalog{
+			input:             input,
+			unknownUser:       unknownUser,
+			unresolvedUsers:   make(map[string]int),
+			unresolvedInIssue: make(map[string]bool),
+		}
+		err error
+	)
+	if c.statuses, err = loadLookupEntities(input, "Status"); err != nil {
+		return nil, err
+	}
+	if c.priorities, err = loadLookupEntities(input, "Priority"); err != nil {
+		return nil, err
+	}
+	if c.resolutions, err = loadLookupEntities(input, "Resolution"); err != nil {
+		return nil, err
+	}
+	if c.issueTypes, err = loadLookupEntities(input, "IssueType"); err != nil {
+		return nil, err
+	}
+	if c.users, err = loadUsers(input); err != nil {
+		return nil, err
+	}
+	if c.customFields, c.customFieldOptions, err = loadCustomFields(input); err != nil {
+		return nil, err
+	}
+	if c.sprints, err = loadSprints(input); err != nil {
+		return nil, err
+	}
+	if c.issueKeys, err = loadIssueKeys(input); err != nil {
+		return nil, err
+	}
+	if c.issueLinkTypes, c.issueLinks, err = loadIssueLinks(input); err != nil {
+		return nil, err
+	}
+	if c.hierarchy, err = loadHierarchy(input, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// applicationUser maps the user keys used throughout JIRA to a username.
+// For older users the key is the username, newer ones get keys like JIRAUSER12345.
+type applicationUser struct {
+	UserKey       string `xml:"userKey,attr"`
+	LowerUserName string `xml:"lowerUserName,attr"`
+}
+
+// crowdUser is a User element (cwd_user table), the user's details in one of the user directories.
+type crowdUser struct {
+	DirectoryId   int    `xml:"directoryId,attr"`
+	LowerUserName string `xml:"lowerUserName,attr"`
+	DisplayName   string `xml:"displayName,attr"`
+	EmailAddress  string `xml:"emailAddress,attr"`
+	Active        int    `xml:"active,attr"`
+}
+
+func loadUsers(input fs.FS) (map[string]OutputUser, error) {
+	crowdUsers := make(map[string]crowdUser)
+	err := forEachEntity(input, "User", func(b []byte, file string) error {
+		var u crowdUser
+		if err := xml.Unmarshal(b, &u); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		// The same user can be in several directories, JIRA uses the first directory.
+		// Without the directory order, prefer an active user then the lowest directory
+		existing, ok := crowdUsers[u.LowerUserName]
+		if !ok || (u.Active > existing.Active) || (u.Active == existing.Active && u.DirectoryId < existing.DirectoryId) {
+			crowdUsers[u.LowerUserName] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]OutputUser)
+	err = forEachEntity(input, "ApplicationUser", func(b []byte, file string) error {
+		var au applicationUser
+		if err := xml.Unmarshal(b, &au); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		cu := crowdUsers[au.LowerUserName]
+		users[au.UserKey] = OutputUser{
+			Key:         au.UserKey,
+			UserName:    au.LowerUserName,
+			DisplayName: cu.DisplayName,
+			Email:       cu.EmailAddress,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Users from before ApplicationUser existed are keyed by their username
+	for name, cu := range crowdUsers {
+		if _, ok := users[name]; !ok {
+			users[name] = OutputUser{
+				Key:         name,
+				UserName:    name,
+				DisplayName: cu.DisplayName,
+				Email:       cu.EmailAddress,
+			}
+		}
+	}
+	return users, nil
+}
+
+// forEachEntity calls fn with the content of each <dir>/*.xml file.
+func forEachEntity(input fs.FS, dir string, fn func(b []byte, file string) error) error {
+	entries, err := fs.ReadDir(input, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".xml") {
+			continue
+		}
+		file := fmt.Sprintf("%v/%v", dir, entry.Name())
+		b, err := fs.ReadFile(input, file)
+		if err != nil {
+			return err
+		}
+		if err = fn(b, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLookupEntities reads either layout step1 produces: <dir>/<id>.xml or <dir>/<id>/<name>.xml
+func loadLookupEntities(input fs.FS, dir string) (map[int]lookupEntity, error) {
+	result := make(map[int]lookupEntity)
+	entries, err := fs.ReadDir(input, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		file := fmt.Sprintf("%v/%v", dir, entry.Name())
+		if entry.IsDir() {
+			file, err = findOneFile(input, file, ".xml")
+			if err != nil {
+				return nil, err
+			}
+			if file == "" {
+				continue
+			}
+		} else if !strings.HasSuffix(file, ".xml") {
+			continue
+		}
+		b, err := fs.ReadFile(input, file)
+		if err != nil {
+			return nil, err
+		}
+		// Not using unmarshal(), these have plenty of attributes we don't care about
+		var e lookupEntity
+		err = xml.Unmarshal(b, &e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		result[e.Id] = e
+	}
+	return result, nil
+}
+
+// resolveNames fills in the human names for the issue's ids.
+func (c *catalog) resolveNames(output *OutputIssue) {
+	output.TypeName = c.issueTypes[output.Type].Name
+	output.PriorityName = c.priorities[output.Priority].Name
+	status := c.statuses[output.Status]
+	output.StatusName = status.Name
+	output.StatusCategory = statusCategories[status.StatusCategory]
+	if output.Resolution == 0 {
+		output.ResolutionName = "Unresolved"
+	} else {
+		output.ResolutionName = c.resolutions[output.Resolution].Name
+	}
+}
+
+// resolveUsers finds each distinct user key, in order, and notes the ones we don't know.
+func (c *catalog) resolveUsers(keys ...string) []OutputUser {
+	var (
+		result []OutputUser
+		seen   = make(map[string]bool)
+	)
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		user, ok := c.users[key]
+		if !ok {
+			c.unresolvedInIssue[key] = true
+			user = OutputUser{
+				Key:         key,
+				DisplayName: strings.ReplaceAll(c.unknownUser, "{key}", key),
+				Unresolved:  true,
+			}
+		}
+		result = append(result, user)
+	}
+	return result
+}
+
+// countUnresolvedUsers adds the keys we couldn't find in an issue to the counts, once each.
+// Call it when the issue is done.
+func (c *catalog) countUnresolvedUsers() {
+	for key := range c.unresolvedInIssue {
+		c.unresolvedUsers[key]++
+	}
+	clear(c.unresolvedInIssue)
+}
+
+func (c *catalog) reportUnresolvedUsers() {
+	if len(c.unresolvedUsers) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(c.unresolvedUsers))
+	for key := range c.unresolvedUsers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	log.Printf("%v user keys could not be resolved to a user:", len(keys))
+	for _, key := range keys {
+		log.Printf("  %v (on %v issues)", key, c.unresolvedUsers[key])
+	}
+}
+
+func (c *catalog) reportBadEpicLinks() {
+	if len(c.badEpicLinks) == 0 {
+		return
+	}
+	log.Printf("%v Epic Link values aren't an issue id, those issues are shown without their epic:", len(c.badEpicLinks))
+	for _, b := range c.badEpicLinks {
+		log.Printf("  %v", b)
+	}
+}
+
+func (c *catalog) reportMissingAttachments() {
+	if len(c.missingAttachments) == 0 {
+		return
+	}
+	log.Printf("%v attachments could not be found in the backup:", len(c.missingAttachments))
+	for _, m := range c.missingAttachments {
+		log.Printf("  %v", m)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// testBackup is step1's output for a small backup, with the entities the catalog joins.
+func testBackup() fstest.MapFS {
+	files := map[string]string{
+		"Status/1.xml":      `<Status id="1" name="In Review" statuscategory="4"/>`,
+		"Status/3/Done.xml": `<Status id="3" name="Done" statuscategory="3"/>`,
+		"IssueType/1.xml":   `<IssueType id="1" name="Bug"/>`,
+		"Resolution/1.xml":  `<Resolution id="1" name="Fixed"/>`,
+		"Priority/2.xml":    `<Priority id="2" name="High"/>`,
+
+		"User/1.xml":            `<User directoryId="2" lowerUserName="jsmith" displayName="Jo Smith (old)" active="0"/>`,
+		"User/2.xml":            `<User directoryId="1" lowerUserName="jsmith" displayName="Jo Smith" emailAddress="jo@example.com" active="1"/>`,
+		"User/3.xml":            `<User directoryId="1" lowerUserName="legacy" displayName="Lee Gacy" active="1"/>`,
+		"ApplicationUser/1.xml": `<ApplicationUser userKey="JIRAUSER10" lowerUserName="jsmith"/>`,
+
+		"CustomField/10/Team.xml":                  `<CustomField id="10" name="Team" customfieldtypekey="com.atlassian.jira.plugin.system.customfieldtypes:select"/>`,
+		"CustomField/10/CustomFieldOption/1.xml":   `<CustomFieldOption id="1" customfield="10" value="Red"/>`,
+		"CustomField/11/Epic Link.xml":             `<CustomField id="11" name="Epic Link" customfieldtypekey="com.pyxis.greenhopper.jira:gh-epic-link"/>`,
+		"CustomField/12/Sprint.xml":                `<CustomField id="12" name="Sprint" customfieldtypekey="com.pyxis.greenhopper.jira:gh-sprint"/>`,
+		"CustomField/13/Owner.xml":                 `<CustomField id="13" name="Owner" customfieldtypekey="com.atlassian.jira.plugin.system.customfieldtypes:userpicker"/>`,
+		"CustomField/14/Points.xml":                `<CustomField id="14" name="Points" customfieldtypekey="com.atlassian.jira.plugin.system.customfieldtypes:float"/>`,
+		"AO_60DB71_SPRINT/1.xml":                   `<AO_60DB71_SPRINT><ID>1</ID><NAME>Sprint 1</NAME><CLOSED>true</CLOSED><START_DATE>1577959200000</START_DATE></AO_60DB71_SPRINT>`,
+		"IssueLinkType/1/Blocks.xml":               `<IssueLinkType id="1" linkname="Blocks" inward="is blocked by" outward="blocks"/>`,
+		"IssueLinkType/1/IssueLink/1.xml":          `<IssueLink id="1" linktype="1" source="100" destination="101"/>`,
+		"IssueLinkType/2/jira_subtask_link.xml":    `<IssueLinkType id="2" linkname="jira_subtask_link" style="jira_subtask"/>`,
+		"IssueLinkType/2/IssueLink/2.xml":          `<IssueLink id="2" linktype="2" source="100" destination="102"/>`,
+		"Issue/100/RT-1.xml":                       `<Issue id="100" projectKey="RT" number="1" summary="The epic"/>`,
+		"Issue/101/RT-2.xml":                       `<Issue id="101" projectKey="RT" number="2"><summary>Blocked</summary></Issue>`,
+		"Issue/102/RT-3.xml":                       `<Issue id="102" projectKey="RT" number="3" summary="A subtask"/>`,
+		"Issue/103/RT-4.xml":                       `<Issue id="103" projectKey="RT" number="4" summary="In the epic"/>`,
+		"Issue/103/CustomFieldValue/5.xml":         `<CustomFieldValue id="5" issue="103" customfield="11" numbervalue="100.0"/>`,
+		"Issue/104/OTH%2FER-2.xml":                 `<Issue id="104" projectKey="OTH/ER" number="2" summary="Odd key"/>`,
+		"Issue/105/RT-5.xml":                       `<Issue id="105" projectKey="RT" number="5" summary="Bad epic link"/>`,
+		"Issue/105/CustomFieldValue/6.xml":         `<CustomFieldValue id="6" issue="105" customfield="11" numbervalue="RT-1"/>`,
+		"Issue/100/CustomFieldValue/unrelated.txt": `not an entity`,
+	}
+	fs := make(fstest.MapFS)
+	for name, content := range files {
+		fs[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return fs
+}
+
+func loadTestCatalog(t *testing.T) *catalog {
+	t.Helper()
+	c, err := loadCatalog(testBackup(), "{key} (former user)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCatalogNames(t *testing.T) {
+	c := loadTestCatalog(t)
+	tests := []struct {
+		issue Issue
+		want  [5]string // type, status, category, priority, resolution
+	}{
+		{Issue{Type: 1, Status: 1, Priority: 2}, [5]string{"Bug", "In Review", "In Progress", "High", "Unresolved"}},
+		{Issue{Type: 1, Status: 3, Resolution: 1}, [5]string{"Bug", "Done", "Done", "", "Fixed"}},
+	}
+	for _, tt := range tests {
+		output := OutputIssue{Issue: tt.issue}
+		c.resolveNames(&output)
+		got := [5]string{output.TypeName, output.StatusName, output.StatusCategory, output.PriorityName, output.ResolutionName}
+		if got != tt.want {
+			t.Errorf("resolveNames(%+v) got %q, want %q", tt.issue, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogUsers(t *testing.T) {
+	c := loadTestCatalog(t)
+	got := c.resolveUsers("JIRAUSER10", "legacy", "", "gone", "JIRAUSER10")
+	want := []OutputUser{
+		{Key: "JIRAUSER10", UserName: "jsmith", DisplayName: "Jo Smith", Email: "jo@example.com"},
+		{Key: "legacy", UserName: "legacy", DisplayName: "Lee Gacy"},
+		{Key: "gone", DisplayName: "gone (former user)", Unresolved: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveUsers got %+v\nwant %+v", got, want)
+	}
+	c.countUnresolvedUsers()
+	c.resolveUsers("gone")
+	c.countUnresolvedUsers()
+	if n := c.unresolvedUsers["gone"]; n != 2 {
+		t.Errorf("gone was unresolved on %v issues, want 2", n)
+	}
+}
+
+func TestCatalogFields(t *testing.T) {
+	c := loadTestCatalog(t)
+	values := []CustomFieldValue{
+		{Id: 1, CustomField: 10, StringValue: "1"},
+		{Id: 2, CustomField: 12, StringValue: "1"},
+		{Id: 3, CustomField: 13, StringValue: "JIRAUSER10"},
+		{Id: 4, CustomField: 14, NumberValue: "3.0"},
+		{Id: 5, CustomField: 99, StringValue: "x"},
+		{Id: 6, CustomField: 10, StringValue: "7"},
+	}
+	got := c.resolveFields(values)
+	want := []OutputField{
+		{Id: 13, Name: "Owner", Type: "userpicker", Values: []string{"Jo Smith"}},
+		{Id: 14, Name: "Points", Type: "float", Values: []string{"3"}},
+		{Id: 12, Name: "Sprint", Type: "gh-sprint", Values: []string{"Sprint 1"}},
+		{Id: 10, Name: "Team", Type: "select", Values: []string{"Red", "7"}},
+		{Id: 99, Name: "customfield_99", Values: []string{"x"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveFields got %+v\nwant %+v", got, want)
+	}
+
+	sprints := c.resolveSprints(values)
+	wantSprints := []OutputSprint{{Id: 1, Name: "Sprint 1", State: "Closed", Start: "2020-01-02 10:00"}}
+	if !reflect.DeepEqual(sprints, wantSprints) {
+		t.Errorf("resolveSprints got %+v\nwant %+v", sprints, wantSprints)
+	}
+}
+
+func TestCatalogLinksAndHierarchy(t *testing.T) {
+	c := loadTestCatalog(t)
+	if got, want := c.issueKeys[104], "OTH/ER-2"; got != want {
+		t.Errorf("key of 104 got %q, want %q", got, want)
+	}
+	if len(c.badEpicLinks) != 1 {
+		t.Errorf("got bad epic links %q, want the one on RT-5", c.badEpicLinks)
+	}
+
+	links := map[int][]OutputLink{
+		100: {{Id: 1, LinkType: "Blocks", Direction: "outward", Description: "blocks", IssueId: 101, IssueKey: "RT-2"}},
+		101: {{Id: 1, LinkType: "Blocks", Direction: "inward", Description: "is blocked by", IssueId: 100, IssueKey: "RT-1"}},
+		102: nil, // the subtask link is shown as the parent instead
+	}
+	for id, want := range links {
+		if got := c.resolveLinks(id); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveLinks(%v) got %+v\nwant %+v", id, got, want)
+		}
+	}
+
+	epic := &OutputIssueRef{Id: 100, Key: "RT-1", Summary: "The epic"}
+	tests := []struct {
+		id   int
+		want OutputIssue
+	}{
+		{100, OutputIssue{
+			Subtasks:   []OutputIssueRef{{Id: 102, Key: "RT-3", Summary: "A subtask"}},
+			EpicIssues: []OutputIssueRef{{Id: 103, Key: "RT-4", Summary: "In the epic"}},
+		}},
+		{101, OutputIssue{}},
+		{102, OutputIssue{Parent: epic}},
+		{103, OutputIssue{Epic: epic}},
+	}
+	for _, tt := range tests {
+		output := OutputIssue{Issue: Issue{Id: tt.id}}
+		c.hierarchy.resolve(&output)
+		tt.want.Id = tt.id
+		if !reflect.DeepEqual(output, tt.want) {
+			t.Errorf("resolve(%v) got %+v\nwant %+v", tt.id, output, tt.want)
+		}
+	}
+}
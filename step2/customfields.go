@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// customField is the part we need of a CustomField definition.
+type customField struct {
+	Id      int    `xml:"id,attr"`
+	Name    string `xml:"name,attr"`
+	TypeKey string `xml:"customfieldtypekey,attr"`
+}
+
+// Type is the short form of the type key,
+// e.g. select for com.atlassian.jira.plugin.system.customfieldtypes:select
+func (f customField) Type() string {
+	_, t, ok := strings.Cut(f.TypeKey, ":")
+	if !ok {
+		return f.TypeKey
+	}
+	return t
+}
+
+// customFieldOption is a choice for select lists, radio buttons, checkboxes etc.
+type customFieldOption struct {
+	Id             int    `xml:"id,attr"`
+	CustomField    int    `xml:"customfield,attr"`
+	ParentOptionId int    `xml:"parentoptionid,attr"`
+	Value          string `xml:"value,attr"`
+}
+
+// loadCustomFields reads CustomField/<id>/<name>.xml and CustomField/<id>/CustomFieldOption/*.xml
+func loadCustomFields(input fs.FS) (map[int]customField, map[int]customFieldOption, error) {
+	fields := make(map[int]customField)
+	options := make(map[int]customFieldOption)
+	root := "CustomField"
+	entries, err := fs.ReadDir(input, root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fields, options, nil
+		}
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := fmt.Sprintf("%v/%v", root, entry.Name())
+		err = forEachEntity(input, dir, func(b []byte, file string) error {
+			var f customField
+			if err := xml.Unmarshal(b, &f); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			fields[f.Id] = f
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = forEachEntity(input, fmt.Sprintf("%v/CustomFieldOption", dir), func(b []byte, file string) error {
+			var o customFieldOption
+			if err := xml.Unmarshal(b, &o); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			options[o.Id] = o
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return fields, options, nil
+}
+
+// resolveFields joins the issue's custom field values to their definitions and options.
+// The result is sorted by field name.
+func (c *catalog) resolveFields(values []CustomFieldValue) []OutputField {
+	byField := make(map[int][]CustomFieldValue)
+	for _, v := range values {
+		byField[v.CustomField] = append(byField[v.CustomField], v)
+	}
+
+	var result []OutputField
+	for id, vs := range byField {
+		def, ok := c.customFields[id]
+		if !ok {
+			def = customField{Id: id, Name: fmt.Sprintf("customfield_%v", id)}
+		}
+		// cascading selects store the parent with no parentkey, then the child with parentkey 1
+		sort.SliceStable(vs, func(i, j int) bool {
+			if vs[i].ParentKey != vs[j].ParentKey {
+				return vs[i].ParentKey < vs[j].ParentKey
+			}
+			return vs[i].Id < vs[j].Id
+		})
+		field := OutputField{
+			Id:   id,
+			Name: def.Name,
+			Type: def.Type(),
+		}
+		for _, v := range vs {
+			field.Values = append(field.Values, c.formatFieldValue(def, v))
+		}
+		result = append(result, field)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+func (c *catalog) formatFieldValue(def customField, v CustomFieldValue) string {
+	switch def.Type() {
+	case "select", "multiselect", "radiobuttons", "multicheckboxes", "cascadingselect":
+		id, err := strconv.Atoi(v.StringValue)
+		if err != nil {
+			return v.StringValue
+		}
+		if o, ok := c.customFieldOptions[id]; ok {
+			return o.Value
+		}
+		return v.StringValue
+	case "userpicker", "multiuserpicker":
+		users := c.resolveUsers(v.StringValue)
+		if len(users) == 0 || users[0].DisplayName == "" {
+			// no user key, which resolveUsers skips, or an ApplicationUser without a User, like OutputIssue.userName
+			return v.StringValue
+		}
+		return users[0].DisplayName
+	case sprintFieldType:
+		return c.sprintName(v.StringValue)
+	case "datepicker":
+		return formatTime(v.DateValue, "2006-01-02")
+	case "datetime":
+		return formatTime(v.DateValue, "2006-01-02 15:04")
+	}
+
+	switch {
+	case v.StringValue != "":
+		return v.StringValue
+	case v.NumberValue != "":
+		// 3.0 is shown as 3
+		f, err := strconv.ParseFloat(v.NumberValue, 64)
+		if err != nil {
+			return v.NumberValue
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case v.DateValue != "":
+		return formatTime(v.DateValue, "2006-01-02 15:04")
+	}
+	return v.TextValue
+}
+
+func formatTime(s string, layout string) string {
+	t, err := time.Parse(jiraTimeLayout, s)
+	if err != nil {
+		return s
+	}
+	return t.Format(layout)
+}
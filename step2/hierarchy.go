@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+)
+
+const (
+	// link type styles JIRA uses for hierarchy, rather than for user-visible links
+	subtaskLinkStyle   string = "jira_subtask"
+	epicStoryLinkStyle string = "jira_gh_epic_story"
+	epicLinkFieldType  string = "gh-epic-link"
+)
+
+// hierarchyIssue is the part of an Issue we need to place it in the hierarchy.
+type hierarchyIssue struct {
+	Id                        int    `xml:"id,attr"`
+	ProjectKey                string `xml:"projectKey,attr"`
+	Number                    int    `xml:"number,attr"`
+	Summary                   string `xml:"summary"`
+	SummaryAttr               string `xml:"summary,attr"`
+	SubtaskParentId           int    `xml:"subtaskParentId,attr"`
+	EffectiveSubtaskParentId  int    `xml:"effectiveSubtaskParentId,attr"`
+	DenormalisedSubtaskParent int    `xml:"denormalisedSubtaskParent,attr"`
+
+	parentId int
+	epicId   int
+	subtasks []int
+	children []int // for an epic, the issues in it
+}
+
+func (h *hierarchyIssue) ref() OutputIssueRef {
+	return OutputIssueRef{
+		Id:      h.Id,
+		Key:     fmt.Sprintf("%v-%v", h.ProjectKey, h.Number),
+		Summary: h.Summary,
+	}
+}
+
+// hierarchy knows the parent, subtasks and epic of every issue.
+type hierarchy struct {
+	issues map[int]*hierarchyIssue
+}
+
+// loadHierarchy reads every issue once, plus any Epic Link custom field values,
+// because we need to know about all the children of an issue before rendering it.
+func loadHierarchy(input fs.FS, c *catalog) (*hierarchy, error) {
+	h := hierarchy{issues: make(map[int]*hierarchyIssue)}
+	root := "Issue"
+	for id := range c.issueKeys {
+		dir := fmt.Sprintf("%v/%v", root, id)
+		file, err := findOneFile(input, dir, ".xml")
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(input, file)
+		if err != nil {
+			return nil, err
+		}
+		// Not using unmarshal(), we only want a few attributes
+		var hi hierarchyIssue
+		if err = xml.Unmarshal(b, &hi); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		normalizeIntoElements(&hi.SummaryAttr, &hi.Summary)
+		hi.parentId = firstNonZero(hi.SubtaskParentId, hi.EffectiveSubtaskParentId, hi.DenormalisedSubtaskParent)
+		hi.epicId, err = c.readEpicLinkField(fmt.Sprintf("%v/CustomFieldValue", dir))
+		if err != nil {
+			return nil, err
+		}
+		h.issues[hi.Id] = &hi
+	}
+
+	for _, links := range c.issueLinks {
+		for _, l := range links {
+			child, ok := h.issues[l.Destination]
+			if !ok {
+				continue
+			}
+			switch c.issueLinkTypes[l.LinkType].Style {
+			case subtaskLinkStyle:
+				if child.parentId == 0 {
+					child.parentId = l.Source
+				}
+			case epicStoryLinkStyle:
+				if child.epicId == 0 {
+					child.epicId = l.Source
+				}
+			}
+		}
+	}
+
+	for _, hi := range h.issues {
+		if parent, ok := h.issues[hi.parentId]; ok {
+			parent.subtasks = append(parent.subtasks, hi.Id)
+		}
+		if epic, ok := h.issues[hi.epicId]; ok {
+			epic.children = append(epic.children, hi.Id)
+		}
+	}
+	for _, hi := range h.issues {
+		h.sortByKey(hi.subtasks)
+		h.sortByKey(hi.children)
+	}
+	return &h, nil
+}
+
+// readEpicLinkField finds the epic id in an issue's Epic Link custom field, if it has one.
+// A value that isn't a number is left out of the hierarchy and reported at the end.
+func (c *catalog) readEpicLinkField(dir string) (int, error) {
+	epicId := 0
+	err := forEachEntity(c.input, dir, func(b []byte, file string) error {
+		var v struct {
+			CustomField int    `xml:"customfield,attr"`
+			NumberValue string `xml:"numbervalue,attr"`
+		}
+		if err := xml.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if c.customFields[v.CustomField].Type() != epicLinkFieldType {
+			return nil
+		}
+		f, err := strconv.ParseFloat(v.NumberValue, 64)
+		if err != nil {
+			c.badEpicLinks = append(c.badEpicLinks, fmt.Sprintf("%v: numbervalue %q", file, v.NumberValue))
+			return nil
+		}
+		epicId = int(f)
+		return nil
+	})
+	return epicId, err
+}
+
+func (h *hierarchy) sortByKey(ids []int) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := h.issues[ids[i]], h.issues[ids[j]]
+		if a.ProjectKey != b.ProjectKey {
+			return a.ProjectKey < b.ProjectKey
+		}
+		return a.Number < b.Number
+	})
+}
+
+func (h *hierarchy) refs(ids []int) []OutputIssueRef {
+	var result []OutputIssueRef
+	for _, id := range ids {
+		result = append(result, h.issues[id].ref())
+	}
+	return result
+}
+
+// resolve fills in the issue's place in the hierarchy.
+func (h *hierarchy) resolve(output *OutputIssue) {
+	hi, ok := h.issues[output.Id]
+	if !ok {
+		return
+	}
+	if parent, ok := h.issues[hi.parentId]; ok {
+		ref := parent.ref()
+		output.Parent = &ref
+	}
+	if epic, ok := h.issues[hi.epicId]; ok {
+		ref := epic.ref()
+		output.Epic = &ref
+	}
+	output.Subtasks = h.refs(hi.subtasks)
+	output.EpicIssues = h.refs(hi.children)
+}
+
+// renderProjectTrees makes a document per project showing its epics, issues and subtasks.
+func (h *hierarchy) renderProjectTrees() map[string][]byte {
+	byProject := make(map[string][]int)
+	for id, hi := range h.issues {
+		byProject[hi.ProjectKey] = append(byProject[hi.ProjectKey], id)
+	}
+
+	result := make(map[string][]byte)
+	for project, ids := range byProject {
+		h.sortByKey(ids)
+		var (
+			b       bytes.Buffer
+			written = make(map[int]bool)
+		)
+		fmt.Fprintf(&b, "# %v\n\n", project)
+		// Epics first, with everything in them. Then the issues not in an epic.
+		for _, id := range ids {
+			if len(h.issues[id].children) != 0 {
+				h.writeTree(&b, id, 0, written)
+			}
+		}
+		for _, id := range ids {
+			hi := h.issues[id]
+			_, hasParent := h.issues[hi.parentId]
+			_, hasEpic := h.issues[hi.epicId]
+			if !hasParent && !hasEpic {
+				h.writeTree(&b, id, 0, written)
+			}
+		}
+		// Anything left is in a cycle or under an issue in another project
+		for _, id := range ids {
+			h.writeTree(&b, id, 0, written)
+		}
+		result[project] = b.Bytes()
+	}
+	return result
+}
+
+func (h *hierarchy) writeTree(b *bytes.Buffer, id int, depth int, written map[int]bool) {
+	if written[id] {
+		return
+	}
+	written[id] = true
+	hi := h.issues[id]
+	ref := hi.ref()
+	fmt.Fprintf(b, "%*s- %v %v\n", depth*2, "", linkToIssue(ref.Key, ref.Id), plainText(ref.Summary))
+	for _, child := range hi.children {
+		// subtasks are shown under their parent instead
+		if _, ok := h.issues[h.issues[child].parentId]; !ok {
+			h.writeTree(b, child, depth+1, written)
+		}
+	}
+	for _, subtask := range hi.subtasks {
+		h.writeTree(b, subtask, depth+1, written)
+	}
+}
+
+func firstNonZero(values ...int) int {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// issueLinkType names the two directions of a link, e.g. "blocks" and "is blocked by".
+type issueLinkType struct {
+	Id       int    `xml:"id,attr"`
+	LinkName string `xml:"linkname,attr"`
+	Inward   string `xml:"inward,attr"`
+	Outward  string `xml:"outward,attr"`
+	Style    string `xml:"style,attr"`
+}
+
+type issueLink struct {
+	Id          int `xml:"id,attr"`
+	LinkType    int `xml:"linktype,attr"`
+	Source      int `xml:"source,attr"`
+	Destination int `xml:"destination,attr"`
+	Sequence    int `xml:"sequence,attr"`
+}
+
+// loadIssueLinks reads IssueLinkType/<id>/<linkname>.xml and IssueLinkType/<id>/IssueLink/*.xml
+// and indexes the links by both of the issues they join.
+func loadIssueLinks(input fs.FS) (map[int]issueLinkType, map[int][]issueLink, error) {
+	linkTypes := make(map[int]issueLinkType)
+	links := make(map[int][]issueLink)
+	root := "IssueLinkType"
+	entries, err := fs.ReadDir(input, root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return linkTypes, links, nil
+		}
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := fmt.Sprintf("%v/%v", root, entry.Name())
+		err = forEachEntity(input, dir, func(b []byte, file string) error {
+			var lt issueLinkType
+			if err := xml.Unmarshal(b, &lt); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			linkTypes[lt.Id] = lt
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = forEachEntity(input, fmt.Sprintf("%v/IssueLink", dir), func(b []byte, file string) error {
+			var l issueLink
+			if err := xml.Unmarshal(b, &l); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			links[l.Source] = append(links[l.Source], l)
+			if l.Destination != l.Source {
+				links[l.Destination] = append(links[l.Destination], l)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return linkTypes, links, nil
+}
+
+// loadIssueKeys finds the key of every issue from the names of step1's Issue/<id>/<key>.xml files,
+// without needing to read them.
+func loadIssueKeys(input fs.FS) (map[int]string, error) {
+	keys := make(map[int]string)
+	root := "Issue"
+	entries, err := fs.ReadDir(input, root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var id int
+		if _, err := fmt.Sscanf(entry.Name(), "%d", &id); err != nil {
+			continue
+		}
+		file, err := findOneFile(input, fmt.Sprintf("%v/%v", root, entry.Name()), ".xml")
+		if err != nil {
+			return nil, err
+		}
+		if file == "" {
+			continue
+		}
+		key := strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".xml")
+		// step1 percent-encodes anything unsafe in a filename
+		if unescaped, err := url.PathUnescape(key); err == nil {
+			key = unescaped
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// resolveLinks describes the issue's links from its own point of view.
+func (c *catalog) resolveLinks(issueId int) []OutputLink {
+	var result []OutputLink
+	for _, l := range c.issueLinks[issueId] {
+		lt := c.issueLinkTypes[l.LinkType]
+		if lt.Style == subtaskLinkStyle || lt.Style == epicStoryLinkStyle {
+			// shown as the issue's hierarchy instead
+			continue
+		}
+		link := OutputLink{
+			Id:       l.Id,
+			LinkType: lt.LinkName,
+		}
+		if l.Source == issueId {
+			link.Direction = "outward"
+			link.Description = lt.Outward
+			link.IssueId = l.Destination
+		} else {
+			link.Direction = "inward"
+			link.Description = lt.Inward
+			link.IssueId = l.Source
+		}
+		if link.Description == "" {
+			link.Description = fmt.Sprintf("linktype %v", l.LinkType)
+		}
+		link.IssueKey = c.issueKeys[link.IssueId]
+		result = append(result, link)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Description != result[j].Description {
+			return result[i].Description < result[j].Description
+		}
+		return result[i].IssueId < result[j].IssueId
+	})
+	return result
+}
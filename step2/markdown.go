@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ishepherd/jira-to-markdown/jiramarkup"
+	"github.com/ishepherd/jira-to-markdown/safename"
+)
+
+var (
+	// autolinkRegexp matches a URL Markdown will link to between < and >
+	autolinkRegexp *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]{1,31}:[^\s<>]*$`)
+)
+
+const (
+	// jiraTimeLayout is how timestamps appear in entities.xml, e.g. 2020-01-02 10:00:00.0
+	jiraTimeLayout string = "2006-01-02 15:04:05.999999999"
+)
+
+func renderMarkdown(issue OutputIssue) []byte {
+	var b bytes.Buffer
+	markup := func(content string, headingOffset int) string {
+		return jiramarkup.ToMarkdown(content, jiramarkup.Options{
+			HeadingOffset: headingOffset,
+			Attachment:    issue.attachmentPath,
+			User:          issue.userName,
+		})
+	}
+
+	fmt.Fprintf(&b, "# %v: %v\n\n", issue.Key(), plainText(issue.Summary))
+
+	b.WriteString("| | |\n|---|---|\n")
+	writeRow(&b, "Type", issue.TypeName)
+	status := issue.StatusName
+	// stock statuses have the same name as their category, e.g. Done
+	if !strings.EqualFold(issue.StatusCategory, issue.StatusName) {
+		status = joinNonEmpty(" / ", issue.StatusName, issue.StatusCategory)
+	}
+	writeRow(&b, "Status", status)
+	writeRow(&b, "Priority", issue.PriorityName)
+	writeRow(&b, "Resolution", issue.ResolutionName)
+	if issue.Parent != nil {
+		writeMarkdownRow(&b, "Parent", linkToIssue(issue.Parent.Key, issue.Parent.Id)+" "+plainText(issue.Parent.Summary))
+	}
+	if issue.Epic != nil {
+		writeMarkdownRow(&b, "Epic", linkToIssue(issue.Epic.Key, issue.Epic.Id)+" "+plainText(issue.Epic.Summary))
+	}
+	writeRow(&b, "Reporter", issue.userName(issue.Reporter))
+	writeRow(&b, "Assignee", issue.userName(issue.Assignee))
+	writeRow(&b, "Creator", issue.userName(issue.Creator))
+	writeRow(&b, "Created", formatDate(issue.Created))
+	writeRow(&b, "Updated", formatDate(issue.Updated))
+	writeRow(&b, "Resolved", formatDate(issue.ResolutionDate))
+	writeRow(&b, "Due", formatDate(issue.DueDate))
+	b.WriteString("\n")
+
+	if len(issue.Fields) != 0 {
+		b.WriteString("## Fields\n\n| Field | Value |\n|---|---|\n")
+		for _, f := range issue.Fields {
+			fmt.Fprintf(&b, "| %v | %v |\n", tableCell(f.Name), tableCell(formatField(f)))
+		}
+		b.WriteString("\n")
+	}
+
+	writeIssueList(&b, "Subtasks", issue.Subtasks)
+	writeIssueList(&b, "Issues in this epic", issue.EpicIssues)
+
+	if len(issue.Links) != 0 {
+		b.WriteString("## Links\n\n")
+		for _, l := range issue.Links {
+			fmt.Fprintf(&b, "- %v %v\n", plainText(l.Description), linkToIssue(l.IssueKey, l.IssueId))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(issue.Sprints) != 0 {
+		b.WriteString("## Sprints\n\n| Sprint | State | Start | End |\n|---|---|---|---|\n")
+		for _, s := range issue.Sprints {
+			fmt.Fprintf(&b, "| %v | %v | %v | %v |\n", tableCell(s.Name), tableCell(s.State), tableCell(s.Start), tableCell(s.End))
+		}
+		b.WriteString("\n")
+	}
+
+	writeSection(&b, "Description", markup(issue.Description, 2))
+	writeSection(&b, "Environment", markup(issue.Environment, 2))
+
+	if len(issue.Attachments) != 0 {
+		b.WriteString("## Attachments\n\n| File | Size | Type | Author | Date |\n|---|---|---|---|---|\n")
+		for _, a := range issue.Attachments {
+			file := tableCell(a.FileName)
+			if a.Path != "" {
+				file = fmt.Sprintf("[%v](<%v>)", file, linkTarget(a.Path))
+			} else if a.Missing {
+				file += " (missing)"
+			}
+			fmt.Fprintf(&b, "| %v | %v | %v | %v | %v |\n", file, formatSize(a.FileSize),
+				tableCell(a.MimeType), tableCell(issue.userName(a.Author)), formatDate(a.Created))
+		}
+		b.WriteString("\n")
+	}
+
+	// only if there are comments, not just other actions
+	headed := false
+	for _, action := range issue.Actions {
+		if action.Type != "comment" {
+			continue
+		}
+		if !headed {
+			b.WriteString("## Comments\n\n")
+			headed = true
+		}
+		fmt.Fprintf(&b, "### %v - %v\n\n", plainText(issue.userName(action.Author)), formatDate(action.Created))
+		b.WriteString(markup(action.Body, 3))
+		b.WriteString("\n\n")
+	}
+
+	if len(issue.ChangeGroups) != 0 {
+		b.WriteString("## History\n\n")
+		b.WriteString("| When | Who | Field | From | To |\n|---|---|---|---|---|\n")
+		for _, group := range issue.ChangeGroups {
+			for _, item := range group.Items {
+				fmt.Fprintf(&b, "| %v | %v | %v | %v | %v |\n",
+					formatDate(group.Created), tableCell(issue.userName(group.Author)), tableCell(item.Field),
+					tableCell(item.From()), tableCell(item.To()))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.Bytes()
+}
+
+// linkToIssue links to another issue's markdown file, which is in the same directory as this one.
+func linkToIssue(key string, id int) string {
+	if key == "" {
+		// not in the backup
+		return fmt.Sprintf("issue %v", id)
+	}
+	return fmt.Sprintf("[%v](<%v.md>)", key, linkTarget(safename.Encode(key)))
+}
+
+func writeIssueList(b *bytes.Buffer, heading string, refs []OutputIssueRef) {
+	if len(refs) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "## %v\n\n", heading)
+	for _, ref := range refs {
+		fmt.Fprintf(b, "- %v %v\n", linkToIssue(ref.Key, ref.Id), plainText(ref.Summary))
+	}
+	b.WriteString("\n")
+}
+
+func writeRow(b *bytes.Buffer, name string, value string) {
+	// JIRA only serializes fields that have a value, so skip the empty ones too
+	if value == "" {
+		return
+	}
+	writeMarkdownRow(b, name, tableCell(value))
+}
+
+// writeMarkdownRow writes a row whose value is already Markdown that's safe in a table cell.
+func writeMarkdownRow(b *bytes.Buffer, name string, value string) {
+	fmt.Fprintf(b, "| %v | %v |\n", name, value)
+}
+
+func writeSection(b *bytes.Buffer, heading string, content string) {
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	fmt.Fprintf(b, "## %v\n\n%v\n\n", heading, content)
+}
+
+func joinNonEmpty(sep string, values ...string) string {
+	var nonEmpty []string
+	for _, v := range values {
+		if v != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
+
+func tableCell(s string) string {
+	return strings.ReplaceAll(oneLine(s), "|", `\|`)
+}
+
+// plainText is text from JIRA on one line, e.g. a link type's name, escaped so Markdown shows it as it is.
+func plainText(s string) string {
+	return jiramarkup.Escape(oneLine(s))
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func formatDate(s string) string {
+	if s == "" {
+		return ""
+	}
+	return formatTime(s, "2006-01-02 15:04")
+}
+
+// formatField shows the field's values the way JIRA would for the field's type.
+func formatField(f OutputField) string {
+	switch f.Type {
+	case "cascadingselect":
+		return strings.Join(f.Values, " - ")
+	case "url":
+		links := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			if autolinkRegexp.MatchString(v) {
+				links[i] = "<" + v + ">"
+			} else {
+				// Markdown wouldn't make it a link
+				links[i] = plainText(v)
+			}
+		}
+		return strings.Join(links, ", ")
+	}
+	return strings.Join(f.Values, ", ")
+}
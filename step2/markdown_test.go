@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testIssue is an issue with a bit of everything, as step2 would have resolved it.
+func testIssue() OutputIssue {
+	issue := OutputIssue{
+		Issue: Issue{
+			ProjectKey:  "RT",
+			Number:      1,
+			Id:          100,
+			Summary:     "Fix the *login* page",
+			Description: "h1. Steps\nAsk [~jsmith] to *try* it",
+			Reporter:    "jsmith",
+			Assignee:    "JIRAUSER10",
+			Created:     "2020-01-02 10:00:00.0",
+		},
+		TypeName:       "Bug",
+		StatusName:     "In Review",
+		StatusCategory: "In Progress",
+		PriorityName:   "High",
+		ResolutionName: "Unresolved",
+		Users: []OutputUser{
+			{Key: "jsmith", DisplayName: "Jo Smith"},
+			{Key: "JIRAUSER10", DisplayName: "Sam Lee"},
+		},
+		Actions: []OutputAction{
+			{Action{Author: "jsmith", Type: "comment", Body: "Looks _good_", Created: "2020-01-03 11:00:00.0"}},
+		},
+		Fields: []OutputField{
+			{Id: 10, Name: "Team", Type: "select", Values: []string{"Red | Blue"}},
+			{Id: 11, Name: "Docs", Type: "url", Values: []string{"https://example.com/a", "not a url"}},
+		},
+		Links: []OutputLink{
+			{Id: 1, Direction: "outward", Description: "blocks", IssueId: 101, IssueKey: "RT-2"},
+			{Id: 2, Direction: "inward", Description: "is [cloned] by", IssueId: 999},
+		},
+		Parent:   &OutputIssueRef{Id: 50, Key: "RT-50", Summary: "Epic-ish #1"},
+		Subtasks: []OutputIssueRef{{Id: 102, Key: "RT-3", Summary: "Sub_task"}},
+		ChangeGroups: []OutputChangeGroup{
+			{
+				ChangeGroup: ChangeGroup{Author: "JIRAUSER10", Created: "2020-01-04 12:00:00.0"},
+				Items:       []OutputChangeItem{{ChangeItem{Field: "status", OldString: "Open", NewString: "In Review"}}},
+			},
+		},
+	}
+	return issue
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(issue *OutputIssue)
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "everything",
+			edit: func(issue *OutputIssue) {},
+			want: []string{
+				"# RT-1: Fix the \\*login\\* page\n",
+				"| Type | Bug |\n",
+				"| Status | In Review / In Progress |\n",
+				"| Parent | [RT-50](<RT-50.md>) Epic-ish \\#1 |\n",
+				"| Reporter | Jo Smith |\n",
+				"| Assignee | Sam Lee |\n",
+				"| Created | 2020-01-02 10:00 |\n",
+				"## Fields\n\n| Field | Value |\n|---|---|\n| Team | Red \\| Blue |\n| Docs | <https://example.com/a>, not a url |\n",
+				"## Subtasks\n\n- [RT-3](<RT-3.md>) Sub\\_task\n",
+				"## Links\n\n- blocks [RT-2](<RT-2.md>)\n- is \\[cloned\\] by issue 999\n",
+				"## Description\n\n### Steps\n\nAsk Jo Smith to **try** it\n",
+				"## Comments\n\n### Jo Smith - 2020-01-03 11:00\n\nLooks _good_\n",
+				"## History\n\n| When | Who | Field | From | To |\n|---|---|---|---|---|\n| 2020-01-04 12:00 | Sam Lee | status | Open | In Review |\n",
+			},
+			notWant: []string{"@jsmith", "## Attachments", "## Sprints"},
+		},
+		{
+			name: "status the same as its category",
+			edit: func(issue *OutputIssue) {
+				issue.StatusName, issue.StatusCategory = "Done", "Done"
+			},
+			want:    []string{"| Status | Done |\n"},
+			notWant: []string{"Done / Done"},
+		},
+		{
+			name: "no comments, only other actions",
+			edit: func(issue *OutputIssue) {
+				issue.Actions[0].Type = "worklog"
+			},
+			notWant: []string{"## Comments"},
+		},
+		{
+			name: "unresolved user",
+			edit: func(issue *OutputIssue) {
+				issue.Users = nil
+			},
+			want: []string{"| Reporter | jsmith |\n", "Ask jsmith to"},
+		},
+		{
+			name: "attachment with % and a space in its name",
+			edit: func(issue *OutputIssue) {
+				issue.Description = "See !50% done.png! and [^50% done.png]"
+				issue.Attachments = []OutputAttachment{
+					{FileAttachment: FileAttachment{FileName: "50% done.png"}, Path: "RT-1/50% done.png"},
+				}
+			},
+			want: []string{
+				"![50% done.png](<RT-1/50%25 done.png>)",
+				"[50% done.png](<RT-1/50%25 done.png>)",
+				"| [50% done.png](<RT-1/50%25 done.png>) |",
+			},
+			notWant: []string{"(<RT-1/50% done.png>)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := testIssue()
+			tt.edit(&issue)
+			got := string(renderMarkdown(issue))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("want %q in\n%v", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("don't want %q in\n%v", notWant, got)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,36 @@
 package main
 
+import (
+	"encoding/xml"
+
+	"github.com/ishepherd/jira-to-markdown/jiramarkup"
+)
+
 type OutputIssue struct {
+	XMLName xml.Name `xml:"Issue" json:"-"`
 	Issue
-	Actions      []OutputAction
-	ChangeGroups []OutputChangeGroup
+	// Names for the ids on the Issue, see catalog
+	TypeName       string `xml:"typeName,attr,omitempty"`
+	StatusName     string `xml:"statusName,attr,omitempty"`
+	StatusCategory string `xml:"statusCategory,attr,omitempty"`
+	PriorityName   string `xml:"priorityName,attr,omitempty"`
+	ResolutionName string `xml:"resolutionName,attr,omitempty"`
+	// Users are everyone referred to by the issue and its actions
+	Users []OutputUser `xml:"User"`
+
+	Actions           []OutputAction      `xml:"Action"`
+	CustomFieldValues []CustomFieldValue  `xml:"CustomFieldValue"`
+	Fields            []OutputField       `xml:"Field"`
+	Sprints           []OutputSprint      `xml:"Sprint"`
+	Links             []OutputLink        `xml:"Link"`
+	Attachments       []OutputAttachment  `xml:"FileAttachment"`
+	Parent            *OutputIssueRef     `xml:"Parent"`
+	Epic              *OutputIssueRef     `xml:"Epic"`
+	Subtasks          []OutputIssueRef    `xml:"Subtask"`
+	EpicIssues        []OutputIssueRef    `xml:"EpicIssue"`
+	ChangeGroups      []OutputChangeGroup `xml:"ChangeGroup"`
+	// Other has the content of the child dirs we don't model yet
+	Other []RawElement `xml:",any"`
 }
 
 type OutputAction struct {
@@ -12,4 +39,102 @@ type OutputAction struct {
 
 type OutputChangeGroup struct {
 	ChangeGroup
+	Items []OutputChangeItem `xml:"ChangeItem"`
+}
+
+type OutputChangeItem struct {
+	ChangeItem
+}
+
+type OutputUser struct {
+	Key         string `xml:"key,attr"`
+	UserName    string `xml:"userName,attr,omitempty"`
+	DisplayName string `xml:"displayName,attr,omitempty"`
+	Email       string `xml:"email,attr,omitempty"`
+	// Unresolved is set when the key wasn't found, e.g. the user was deleted
+	Unresolved bool `xml:"unresolved,attr,omitempty"`
+}
+
+// userName is how to show the user with this key.
+func (o OutputIssue) userName(key string) string {
+	for _, u := range o.Users {
+		if u.Key == key && u.DisplayName != "" {
+			return u.DisplayName
+		}
+	}
+	return key
+}
+
+// userKeys are all the user keys referred to by the issue, its actions and history,
+// including those mentioned in the text.
+func (o OutputIssue) userKeys() []string {
+	keys := []string{o.Reporter, o.Assignee, o.Creator}
+	keys = append(keys, jiramarkup.Mentions(o.Description)...)
+	keys = append(keys, jiramarkup.Mentions(o.Environment)...)
+	for _, a := range o.Actions {
+		keys = append(keys, a.Author, a.UpdateAuthor)
+		keys = append(keys, jiramarkup.Mentions(a.Body)...)
+	}
+	for _, cg := range o.ChangeGroups {
+		keys = append(keys, cg.Author)
+	}
+	for _, a := range o.Attachments {
+		keys = append(keys, a.Author)
+	}
+	return keys
+}
+
+// OutputField is a custom field with its values made readable, e.g. option ids replaced by their labels.
+type OutputField struct {
+	Id     int      `xml:"id,attr"`
+	Name   string   `xml:"name,attr"`
+	Type   string   `xml:"type,attr,omitempty"`
+	Values []string `xml:"Value"`
+}
+
+// OutputLink is one end of an IssueLink, seen from the issue it's attached to.
+type OutputLink struct {
+	Id       int    `xml:"id,attr"`
+	LinkType string `xml:"linkType,attr,omitempty"`
+	// Direction is outward if this issue is the link's source
+	Direction   string `xml:"direction,attr"`
+	Description string `xml:"description,attr"` // e.g. "blocks" or "is blocked by"
+	IssueId     int    `xml:"issueId,attr"`
+	IssueKey    string `xml:"issueKey,attr,omitempty"`
+}
+
+// OutputIssueRef refers to another issue, e.g. a parent or subtask.
+type OutputIssueRef struct {
+	Id      int    `xml:"id,attr"`
+	Key     string `xml:"key,attr"`
+	Summary string `xml:"summary,attr,omitempty"`
+}
+
+type OutputAttachment struct {
+	FileAttachment
+	// Path is where the attachment was copied to, relative to the markdown files
+	Path string `xml:"path,attr,omitempty"`
+	// Missing is set when the attachment's file isn't in the backup
+	Missing bool `xml:"missing,attr,omitempty"`
+}
+
+// attachmentPath is where to find the newest attachment with this filename, like JIRA shows.
+// It's a link target, so a % in the name is escaped.
+func (o OutputIssue) attachmentPath(filename string) string {
+	for i := len(o.Attachments) - 1; i >= 0; i-- {
+		a := o.Attachments[i]
+		if a.FileName == filename && a.Path != "" {
+			return linkTarget(a.Path)
+		}
+	}
+	return linkTarget(filename)
+}
+
+type OutputSprint struct {
+	Id       int    `xml:"id,attr"`
+	Name     string `xml:"name,attr"`
+	State    string `xml:"state,attr,omitempty"`
+	Start    string `xml:"start,attr,omitempty"`
+	End      string `xml:"end,attr,omitempty"`
+	Complete string `xml:"complete,attr,omitempty"`
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// progressInterval is how often to log progress
+	progressInterval time.Duration = 5 * time.Second
+)
+
+// progress logs how many issues have been written, and how fast.
+type progress struct {
+	total      int
+	done       int
+	started    time.Time
+	lastReport time.Time
+}
+
+func newProgress(total int) *progress {
+	now := time.Now()
+	return &progress{total: total, started: now, lastReport: now}
+}
+
+// issue counts an issue, and logs progress now and then.
+func (p *progress) issue() {
+	p.done++
+	if now := time.Now(); now.Sub(p.lastReport) >= progressInterval {
+		p.lastReport = now
+		p.report(now)
+	}
+}
+
+func (p *progress) report(now time.Time) {
+	elapsed := now.Sub(p.started)
+	rate := float64(p.done) / elapsed.Seconds()
+	if p.done == p.total || rate == 0 {
+		log.Printf("%v of %v issues in %v, %.0f issues/s", p.done, p.total, elapsed.Round(time.Second), rate)
+		return
+	}
+	eta := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+	log.Printf("%v of %v issues, %.0f issues/s, ETA %v", p.done, p.total, rate, eta.Round(time.Second))
+}
+
+func (p *progress) finish() {
+	p.report(time.Now())
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+)
+
+const (
+	// sprintTable is where JIRA Software keeps sprints, split out of activeobjects.xml by step1
+	sprintTable     string = "AO_60DB71_SPRINT"
+	sprintFieldType string = "gh-sprint"
+)
+
+// sprint is a row of AO_60DB71_SPRINT. Dates are in milliseconds since 1970.
+type sprint struct {
+	Id           int    `xml:"ID"`
+	Name         string `xml:"NAME"`
+	Closed       bool   `xml:"CLOSED"`
+	Started      bool   `xml:"STARTED"`
+	StartDate    int64  `xml:"START_DATE"`
+	EndDate      int64  `xml:"END_DATE"`
+	CompleteDate int64  `xml:"COMPLETE_DATE"`
+}
+
+func (s sprint) state() string {
+	switch {
+	case s.Closed:
+		return "Closed"
+	case s.Started:
+		return "Active"
+	}
+	return "Future"
+}
+
+func loadSprints(input fs.FS) (map[int]sprint, error) {
+	sprints := make(map[int]sprint)
+	err := forEachEntity(input, sprintTable, func(b []byte, file string) error {
+		var s sprint
+		if err := xml.Unmarshal(b, &s); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		sprints[s.Id] = s
+		return nil
+	})
+	return sprints, err
+}
+
+// resolveSprints finds the sprints the issue has been in, from its Sprint custom field.
+func (c *catalog) resolveSprints(values []CustomFieldValue) []OutputSprint {
+	var result []OutputSprint
+	for _, v := range values {
+		if c.customFields[v.CustomField].Type() != sprintFieldType {
+			continue
+		}
+		id, err := strconv.Atoi(v.StringValue)
+		if err != nil {
+			continue
+		}
+		s, ok := c.sprints[id]
+		if !ok {
+			result = append(result, OutputSprint{Id: id, Name: fmt.Sprintf("sprint %v", id)})
+			continue
+		}
+		result = append(result, OutputSprint{
+			Id:       s.Id,
+			Name:     s.Name,
+			State:    s.state(),
+			Start:    formatMillis(s.StartDate),
+			End:      formatMillis(s.EndDate),
+			Complete: formatMillis(s.CompleteDate),
+		})
+	}
+	return result
+}
+
+func (c *catalog) sprintName(id string) string {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return id
+	}
+	if s, ok := c.sprints[n]; ok {
+		return s.Name
+	}
+	return id
+}
+
+func formatMillis(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format("2006-01-02 15:04")
+}
@@ -1,26 +1,49 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/ishepherd/jira-to-markdown/archive"
+	"github.com/ishepherd/jira-to-markdown/safename"
 	cli "github.com/jawher/mow.cli"
 )
 
 func main() {
-	app := cli.App(flag.CommandLine.Name(), `step 2 - Condense each JIRA issue's dir into a single XML file`)
-	app.Spec = "[-o]"
+	app := cli.App(flag.CommandLine.Name(), `step 2 - Write a markdown file for each JIRA issue
+
+Reads the Issue dirs step1 wrote and writes each issue as markdown, with its comments, history,
+fields, links and attachments, and a tree of each project's issues.
+Each issue's dir is also condensed into a single XML file, and optionally JSON.`)
+	app.Spec = "[-o] [-m] [-c] [-j] [-a [--link]] [--unknown-user]"
 	var (
-		outputDir = app.StringOpt("o outputDir", "/Volumes/ramdisk/_tmp", "the output files location from step 1")
+		outputDir    = app.StringOpt("o outputDir", "/Volumes/ramdisk/_tmp", "the output files location from step 1: a dir, or a .tar, .tar.gz or .zip")
+		markdownDir  = app.StringOpt("m markdownDir", "_markdown", "where to write a markdown file for each issue")
+		condensedDir = app.StringOpt("c condensedDir", "_condensed", "where to write the single XML file for each issue")
+		writeJson    = app.BoolOpt("j json", false, "also write each condensed issue as JSON")
+		attachments  = app.StringOpt("a attachmentsDir", "", "the backup's data/attachments directory, to copy attachments next to the markdown files")
+		link         = app.BoolOpt("link", false, "hardlink attachments instead of copying them")
+		unknownUser  = app.StringOpt("unknown-user", "{key}", "how to show users that can't be found, e.g. deleted users. {key} is replaced by the user key")
 	)
 	app.Action = func() {
-		if err := run(*outputDir); err != nil {
+		if err := run(*outputDir, options{
+			markdownDir:  *markdownDir,
+			condensedDir: *condensedDir,
+			writeJson:    *writeJson,
+			unknownUser:  *unknownUser,
+
+			attachmentsDir:  *attachments,
+			linkAttachments: *link,
+		}); err != nil {
 			log.Println(err)
 			cli.Exit(1)
 		}
@@ -32,16 +55,38 @@ func main() {
 	}
 }
 
-func run(outputDir string) error {
-	issueDirs, err := os.ReadDir(fmt.Sprintf("%v/Issue", outputDir))
+type options struct {
+	markdownDir  string
+	condensedDir string
+	writeJson    bool
+	unknownUser  string // how to show a user key that can't be found, {key} is replaced by the key
+
+	attachmentsDir  string
+	linkAttachments bool
+}
+
+func run(outputDir string, opts options) error {
+	// step1's output might be a dir or an archive
+	input, closer, err := archive.Open(outputDir)
 	if err != nil {
 		return err
 	}
+	defer closer.Close()
+	cat, err := loadCatalog(input, opts.unknownUser)
+	if err != nil {
+		return err
+	}
+	issueDirs, err := fs.ReadDir(input, "Issue")
+	if err != nil {
+		return err
+	}
+	prog := newProgress(len(issueDirs))
 	for _, issueDir := range issueDirs {
 		if !issueDir.IsDir() {
+			prog.total--
 			continue
 		}
-		task, err := createTaskData(fmt.Sprintf("%v/Issue/%v", outputDir, issueDir.Name()))
+		task, err := createTaskData(input, fmt.Sprintf("Issue/%v", issueDir.Name()), opts, cat)
 		if err != nil {
 			return err
 		}
@@ -51,17 +96,32 @@ func run(outputDir string) error {
 				return err
 			}
 		}
+		prog.issue()
+	}
+	prog.finish()
+	cat.reportUnresolvedUsers()
+	cat.reportMissingAttachments()
+	cat.reportBadEpicLinks()
+
+	for project, tree := range cat.hierarchy.renderProjectTrees() {
+		err = writeFile(fmt.Sprintf("%v/%v.md", opts.markdownDir, safename.Encode(project)), tree)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 type taskData struct {
-	issueDir     string
+	input        fs.FS  // step1's output
+	issueDir     string // in input
 	issueXmlFile string
+	options
+	catalog *catalog
 }
 
-func createTaskData(issueDir string) (*taskData, error) {
-	issueXmlFile, err := findOneFile(issueDir, ".xml")
+func createTaskData(input fs.FS, issueDir string, opts options, cat *catalog) (*taskData, error) {
+	issueXmlFile, err := findOneFile(input, issueDir, ".xml")
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", issueDir, err)
 	}
@@ -69,14 +129,17 @@ func createTaskData(issueDir string) (*taskData, error) {
 		return nil, nil
 	}
 	return &taskData{
+		input:        input,
 		issueDir:     issueDir,
 		issueXmlFile: issueXmlFile,
+		options:      opts,
+		catalog:      cat,
 	}, nil
 }
 
 func (t taskData) run() error {
 	// Unmarshal the issue XML
-	b, err := os.ReadFile(t.issueXmlFile)
+	b, err := fs.ReadFile(t.input, t.issueXmlFile)
 	if err != nil {
 		return err
 	}
@@ -91,9 +154,12 @@ func (t taskData) run() error {
 	output := OutputIssue{
 		Issue: issue,
 	}
+	t.catalog.resolveNames(&output)
+	output.Links = t.catalog.resolveLinks(issue.Id)
+	t.catalog.hierarchy.resolve(&output)
 
 	// Visit the child directories
-	children, err := os.ReadDir(t.issueDir)
+	children, err := fs.ReadDir(t.input, t.issueDir)
 	if err != nil {
 		return err
 	}
@@ -108,28 +174,74 @@ func (t taskData) run() error {
 				return err
 			}
 			output.Actions = actions
-		// case "ChangeGroup":
-		// 	cg, err := t.readChangeGroup(child)
-		// 	if err != nil {
-		// 		return err
-		// 	}
-		// 	output.ChangeGroup = cg
+		case "CustomFieldValue":
+			values, err := t.readCustomFieldValues(child)
+			if err != nil {
+				return err
+			}
+			output.CustomFieldValues = values
+			output.Fields = t.catalog.resolveFields(values)
+			output.Sprints = t.catalog.resolveSprints(values)
+		case "FileAttachment":
+			attachments, err := t.readAttachments(child, issue)
+			if err != nil {
+				return err
+			}
+			output.Attachments = attachments
+		case "ChangeGroup":
+			changeGroups, err := t.readChangeGroups(child)
+			if err != nil {
+				return err
+			}
+			output.ChangeGroups = changeGroups
 		default:
-			// return fmt.Errorf("Unexpected child dir: %v/%v", t.issueDir, child.Name())
+			// Not modelled, pass it through as-is
+			other, err := t.readRawElements(child)
+			if err != nil {
+				return err
+			}
+			output.Other = append(output.Other, other...)
 		}
 	}
-	return nil
+
+	output.Users = t.catalog.resolveUsers(output.userKeys()...)
+	t.catalog.countUnresolvedUsers()
+
+	err = t.writeCondensed(output)
+	if err != nil {
+		return err
+	}
+	return writeFile(fmt.Sprintf("%v/%v.md", t.markdownDir, safename.Encode(issue.Key())), renderMarkdown(output))
+}
+
+func (t taskData) writeCondensed(output OutputIssue) error {
+	b, err := xml.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%v: %w", t.issueXmlFile, err)
+	}
+	err = writeFile(fmt.Sprintf("%v/%v.xml", t.condensedDir, safename.Encode(output.Key())), b)
+	if err != nil {
+		return err
+	}
+	if !t.writeJson {
+		return nil
+	}
+	b, err = json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%v: %w", t.issueXmlFile, err)
+	}
+	return writeFile(fmt.Sprintf("%v/%v.json", t.condensedDir, safename.Encode(output.Key())), b)
 }
 
 func (t taskData) readActions(child fs.DirEntry) ([]OutputAction, error) {
-	children, err := os.ReadDir(fmt.Sprintf("%v/%v", t.issueDir, child.Name()))
+	children, err := fs.ReadDir(t.input, fmt.Sprintf("%v/%v", t.issueDir, child.Name()))
 	if err != nil {
 		return nil, err
 	}
 	actions := make([]OutputAction, len(children))
 	for i, actionFile := range children {
 		af := fmt.Sprintf("%v/%v/%v", t.issueDir, child.Name(), actionFile.Name())
-		b, err := os.ReadFile(af)
+		b, err := fs.ReadFile(t.input, af)
 		if err != nil {
 			return actions, err
 		}
@@ -141,12 +253,134 @@ func (t taskData) readActions(child fs.DirEntry) ([]OutputAction, error) {
 		normalizeIntoElements(&action.BodyAttr, &action.Body)
 		actions[i] = OutputAction{Action: action}
 	}
-	// TODO sort the slice by date
+	// JIRA's timestamps sort correctly as strings
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Created < actions[j].Created
+	})
 	return actions, nil
 }
 
-func (t taskData) readChangeGroup(child fs.DirEntry) ([]OutputChangeGroup, error) {
-	return []OutputChangeGroup{}, nil // TODO
+// readRawElements reads every XML file under the child dir, however deeply nested.
+func (t taskData) readRawElements(child fs.DirEntry) ([]RawElement, error) {
+	var result []RawElement
+	err := fs.WalkDir(t.input, fmt.Sprintf("%v/%v", t.issueDir, child.Name()), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".xml") {
+			return err
+		}
+		b, err := fs.ReadFile(t.input, path)
+		if err != nil {
+			return err
+		}
+		var el RawElement
+		err = xml.Unmarshal(b, &el)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		result = append(result, el)
+		return nil
+	})
+	return result, err
+}
+
+func (t taskData) readCustomFieldValues(child fs.DirEntry) ([]CustomFieldValue, error) {
+	children, err := fs.ReadDir(t.input, fmt.Sprintf("%v/%v", t.issueDir, child.Name()))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]CustomFieldValue, len(children))
+	for i, valueFile := range children {
+		vf := fmt.Sprintf("%v/%v/%v", t.issueDir, child.Name(), valueFile.Name())
+		b, err := fs.ReadFile(t.input, vf)
+		if err != nil {
+			return values, err
+		}
+		var value CustomFieldValue
+		err = unmarshal(b, &value, vf)
+		if err != nil {
+			return values, err
+		}
+		normalizeIntoElements(&value.StringValueAttr, &value.StringValue)
+		normalizeIntoElements(&value.TextValueAttr, &value.TextValue)
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (t taskData) readChangeGroups(child fs.DirEntry) ([]OutputChangeGroup, error) {
+	// step1 writes these as Issue/<issue>/ChangeGroup/<id>/ChangeGroup.xml and .../ChangeGroup/<id>/ChangeItem/*.xml
+	groupsDir := fmt.Sprintf("%v/%v", t.issueDir, child.Name())
+	children, err := fs.ReadDir(t.input, groupsDir)
+	if err != nil {
+		return nil, err
+	}
+	var changeGroups []OutputChangeGroup
+	for _, groupDir := range children {
+		if !groupDir.IsDir() {
+			continue
+		}
+		dir := fmt.Sprintf("%v/%v", groupsDir, groupDir.Name())
+		cgf, err := findOneFile(t.input, dir, ".xml")
+		if err != nil {
+			return changeGroups, err
+		}
+		if cgf == "" {
+			return changeGroups, fmt.Errorf("%v: no ChangeGroup file", dir)
+		}
+		b, err := fs.ReadFile(t.input, cgf)
+		if err != nil {
+			return changeGroups, err
+		}
+		var changeGroup ChangeGroup
+		err = unmarshal(b, &changeGroup, cgf)
+		if err != nil {
+			return changeGroups, err
+		}
+		items, err := readChangeItems(t.input, fmt.Sprintf("%v/ChangeItem", dir))
+		if err != nil {
+			return changeGroups, err
+		}
+		changeGroups = append(changeGroups, OutputChangeGroup{ChangeGroup: changeGroup, Items: items})
+	}
+	sort.SliceStable(changeGroups, func(i, j int) bool {
+		if changeGroups[i].Created != changeGroups[j].Created {
+			return changeGroups[i].Created < changeGroups[j].Created
+		}
+		return changeGroups[i].Id < changeGroups[j].Id
+	})
+	return changeGroups, nil
+}
+
+func readChangeItems(input fs.FS, dir string) ([]OutputChangeItem, error) {
+	children, err := fs.ReadDir(input, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// a ChangeGroup whose items were all boring
+			return nil, nil
+		}
+		return nil, err
+	}
+	items := make([]OutputChangeItem, len(children))
+	for i, itemFile := range children {
+		cif := fmt.Sprintf("%v/%v", dir, itemFile.Name())
+		b, err := fs.ReadFile(input, cif)
+		if err != nil {
+			return items, err
+		}
+		var item ChangeItem
+		err = unmarshal(b, &item, cif)
+		if err != nil {
+			return items, err
+		}
+		normalizeIntoElements(&item.OldValueAttr, &item.OldValue)
+		normalizeIntoElements(&item.OldStringAttr, &item.OldString)
+		normalizeIntoElements(&item.NewValueAttr, &item.NewValue)
+		normalizeIntoElements(&item.NewStringAttr, &item.NewString)
+		items[i] = OutputChangeItem{ChangeItem: item}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id < items[j].Id
+	})
+	return items, nil
 }
 
 func normalizeIntoElements(attr *string, elem *string) {
@@ -177,6 +411,8 @@ func unmarshal(data []byte, target any, filename string) error {
 			if err = checkNoUnknownNodes(unk); err != nil {
 				return fmt.Errorf("%s: %w", filename, err)
 			}
+			// Nothing of interest left, don't let it be written back out
+			fv.Set(reflect.Zero(fv.Type()))
 			return nil
 		}
 	}
@@ -207,9 +443,8 @@ func checkNoUnknownNodes(u UnknownNodes) error {
 	return nil
 }
 
-func findOneFile(issueDir string, suffix string) (string, error) {
-	// os.Readdirfiles is said to be much faster, but needs opening and closing the dir as an os.File.
-	files, err := os.ReadDir(issueDir)
+func findOneFile(input fs.FS, issueDir string, suffix string) (string, error) {
+	files, err := fs.ReadDir(input, issueDir)
 	if err != nil {
 		return "", err
 	}
@@ -231,3 +466,25 @@ func findOneFile(issueDir string, suffix string) (string, error) {
 	}
 	return fmt.Sprintf("%v/%v", issueDir, found), nil
 }
+
+// linkTarget is a path for a markdown link, with its % escaped so it isn't decoded.
+func linkTarget(path string) string {
+	return strings.ReplaceAll(path, "%", "%25")
+}
+
+func writeFile(name string, content []byte) error {
+	err := ensureDirExists(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, content, 0644)
+}
+
+func ensureDirExists(name string) error {
+	dir := filepath.Dir(name)
+	_, err := os.Stat(dir)
+	if err != nil && os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0700)
+	}
+	return err
+}
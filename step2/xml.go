@@ -1,70 +1,172 @@
 package main
 
-import "encoding/xml"
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+)
 
 type Issue struct {
-	UnknownNodes
-	ProjectKey string `xml:"projectKey,attr"`
-	Number     int    `xml:"number,attr"`
-	Project    int    `xml:"project,attr"`
-	Id         int    `xml:"id,attr"`
-
-	Summary     string `xml:"summary"`
-	SummaryAttr string `xml:"summary,attr"`
-
-	Description     string `xml:"description"`
-	DescriptionAttr string `xml:"description,attr"`
-
-	Environment     string `xml:"environment"`
-	EnvironmentAttr string `xml:"environment,attr"`
-
-	Reporter                  string `xml:"reporter,attr"`
-	Assignee                  string `xml:"assignee,attr"`
-	Creator                   string `xml:"creator,attr"`
-	Type                      int    `xml:"type,attr"`
-	Priority                  int    `xml:"priority,attr"`
-	Resolution                int    `xml:"resolution,attr"`
-	Status                    int    `xml:"status,attr"`
-	Created                   string `xml:"created,attr"`
-	Updated                   string `xml:"updated,attr"`
-	ResolutionDate            string `xml:"resolutiondate,attr"`
-	DueDate                   string `xml:"duedate,attr"`
-	Votes                     int    `xml:"votes,attr"`
-	Watches                   int    `xml:"watches,attr"`
-	WorkflowId                int    `xml:"workflowId,attr"`
-	EffectiveSubtaskParentId  int    `xml:"effectiveSubtaskParentId,attr"`
-	LifecycleState            string `xml:"lifecycleState,attr"`
-	TimeOriginalEstimate      int    `xml:"timeoriginalestimate,attr"`
-	TimeEstimate              int    `xml:"timeestimate,attr"`
-	TimeSpent                 int    `xml:"timespent,attr"`
-	DenormalisedSubtaskParent int    `xml:"denormalisedSubtaskParent,attr"`
-	SubtaskParentId           int    `xml:"subtaskParentId,attr"`
-	ReadExternal              bool   `xml:"read_external,attr"`
-	SoftArchived              bool   `xml:"softArchived,attr"`
+	UnknownNodes `json:"-"`
+	ProjectKey   string `xml:"projectKey,attr,omitempty"`
+	Number       int    `xml:"number,attr,omitempty"`
+	Project      int    `xml:"project,attr,omitempty"`
+	Id           int    `xml:"id,attr,omitempty"`
+
+	Summary     string `xml:"summary,omitempty"`
+	SummaryAttr string `xml:"summary,attr,omitempty" json:"-"`
+
+	Description     string `xml:"description,omitempty"`
+	DescriptionAttr string `xml:"description,attr,omitempty" json:"-"`
+
+	Environment     string `xml:"environment,omitempty"`
+	EnvironmentAttr string `xml:"environment,attr,omitempty" json:"-"`
+
+	Reporter                  string `xml:"reporter,attr,omitempty"`
+	Assignee                  string `xml:"assignee,attr,omitempty"`
+	Creator                   string `xml:"creator,attr,omitempty"`
+	Type                      int    `xml:"type,attr,omitempty"`
+	Priority                  int    `xml:"priority,attr,omitempty"`
+	Resolution                int    `xml:"resolution,attr,omitempty"`
+	Status                    int    `xml:"status,attr,omitempty"`
+	Created                   string `xml:"created,attr,omitempty"`
+	Updated                   string `xml:"updated,attr,omitempty"`
+	ResolutionDate            string `xml:"resolutiondate,attr,omitempty"`
+	DueDate                   string `xml:"duedate,attr,omitempty"`
+	Votes                     int    `xml:"votes,attr,omitempty"`
+	Watches                   int    `xml:"watches,attr,omitempty"`
+	WorkflowId                int    `xml:"workflowId,attr,omitempty"`
+	EffectiveSubtaskParentId  int    `xml:"effectiveSubtaskParentId,attr,omitempty"`
+	LifecycleState            string `xml:"lifecycleState,attr,omitempty"`
+	TimeOriginalEstimate      int    `xml:"timeoriginalestimate,attr,omitempty"`
+	TimeEstimate              int    `xml:"timeestimate,attr,omitempty"`
+	TimeSpent                 int    `xml:"timespent,attr,omitempty"`
+	DenormalisedSubtaskParent int    `xml:"denormalisedSubtaskParent,attr,omitempty"`
+	SubtaskParentId           int    `xml:"subtaskParentId,attr,omitempty"`
+	ReadExternal              bool   `xml:"read_external,attr,omitempty"`
+	SoftArchived              bool   `xml:"softArchived,attr,omitempty"`
+}
+
+// Key is the human-facing issue key, e.g. MYPROJ-1
+func (i Issue) Key() string {
+	return fmt.Sprintf("%v-%v", i.ProjectKey, i.Number)
 }
 
 type Action struct {
-	UnknownNodes
-	Id     int    `xml:"id,attr"`
-	Issue  int    `xml:"issue,attr"`
-	Author string `xml:"author,attr"`
-	Type   string `xml:"type,attr"`
-
-	Body     string `xml:"body"`
-	BodyAttr string `xml:"body,attr"`
-
-	Created      string `xml:"created,attr"`
-	UpdateAuthor string `xml:"updateauthor,attr"`
-	Updated      string `xml:"updated,attr"`
+	UnknownNodes `json:"-"`
+	Id           int    `xml:"id,attr,omitempty"`
+	Issue        int    `xml:"issue,attr,omitempty"`
+	Author       string `xml:"author,attr,omitempty"`
+	Type         string `xml:"type,attr,omitempty"`
+
+	Body     string `xml:"body,omitempty"`
+	BodyAttr string `xml:"body,attr,omitempty" json:"-"`
+
+	Created      string `xml:"created,attr,omitempty"`
+	UpdateAuthor string `xml:"updateauthor,attr,omitempty"`
+	Updated      string `xml:"updated,attr,omitempty"`
 }
 
 type ChangeGroup struct {
-	UnknownNodes
+	UnknownNodes `json:"-"`
+	Id           int    `xml:"id,attr,omitempty"`
+	Issue        int    `xml:"issue,attr,omitempty"`
+	Author       string `xml:"author,attr,omitempty"`
+	Created      string `xml:"created,attr,omitempty"`
+}
+
+type ChangeItem struct {
+	UnknownNodes `json:"-"`
+	Id           int    `xml:"id,attr,omitempty"`
+	Group        int    `xml:"group,attr,omitempty"`
+	FieldType    string `xml:"fieldtype,attr,omitempty"`
+	Field        string `xml:"field,attr,omitempty"`
+
+	OldValue     string `xml:"oldvalue,omitempty"`
+	OldValueAttr string `xml:"oldvalue,attr,omitempty" json:"-"`
+
+	OldString     string `xml:"oldstring,omitempty"`
+	OldStringAttr string `xml:"oldstring,attr,omitempty" json:"-"`
+
+	NewValue     string `xml:"newvalue,omitempty"`
+	NewValueAttr string `xml:"newvalue,attr,omitempty" json:"-"`
+
+	NewString     string `xml:"newstring,omitempty"`
+	NewStringAttr string `xml:"newstring,attr,omitempty" json:"-"`
+}
+
+type CustomFieldValue struct {
+	UnknownNodes `json:"-"`
+	Id           int    `xml:"id,attr,omitempty"`
+	Issue        int    `xml:"issue,attr,omitempty"`
+	CustomField  int    `xml:"customfield,attr,omitempty"`
+	ParentKey    string `xml:"parentkey,attr,omitempty"`
+	ValueType    string `xml:"valuetype,attr,omitempty"`
+
+	StringValue     string `xml:"stringvalue,omitempty"`
+	StringValueAttr string `xml:"stringvalue,attr,omitempty" json:"-"`
+
+	NumberValue string `xml:"numbervalue,attr,omitempty"`
+
+	TextValue     string `xml:"textvalue,omitempty"`
+	TextValueAttr string `xml:"textvalue,attr,omitempty" json:"-"`
+
+	DateValue string `xml:"datevalue,attr,omitempty"`
+}
+
+type FileAttachment struct {
+	UnknownNodes  `json:"-"`
+	Id            int    `xml:"id,attr,omitempty"`
+	Issue         int    `xml:"issue,attr,omitempty"`
+	MimeType      string `xml:"mimetype,attr,omitempty"`
+	FileName      string `xml:"filename,attr,omitempty"`
+	Created       string `xml:"created,attr,omitempty"`
+	FileSize      int64  `xml:"filesize,attr,omitempty"`
+	Author        string `xml:"author,attr,omitempty"`
+	Zip           int    `xml:"zip,attr,omitempty"`
+	Thumbnailable int    `xml:"thumbnailable,attr,omitempty"`
 }
 
+// From is the value before the change, as JIRA displayed it if known
+func (c ChangeItem) From() string {
+	if c.OldString != "" {
+		return c.OldString
+	}
+	return c.OldValue
+}
+
+// To is the value after the change, as JIRA displayed it if known
+func (c ChangeItem) To() string {
+	if c.NewString != "" {
+		return c.NewString
+	}
+	return c.NewValue
+}
+
+// UnknownNodes catches anything in the XML we didn't expect, see checkNoUnknownNodes.
+// It is emptied after checking so it's never written back out.
 type UnknownNodes struct {
 	Unknown      []any      `xml:",any"`
 	UnknownAttrs []xml.Attr `xml:",any,attr"`
 	CharData     string     `xml:",chardata"`
 	Comment      string     `xml:",comment"`
 }
+
+// RawElement holds an element we don't model (yet) so it can be passed through as-is.
+type RawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+func (r RawElement) MarshalJSON() ([]byte, error) {
+	attrs := make(map[string]string, len(r.Attrs))
+	for _, a := range r.Attrs {
+		attrs[a.Name.Local] = a.Value
+	}
+	return json.Marshal(struct {
+		Name    string
+		Attrs   map[string]string
+		Content string `json:",omitempty"`
+	}{r.XMLName.Local, attrs, r.Inner})
+}